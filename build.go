@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ioanzicu/monkeyd/compiler"
+	"github.com/ioanzicu/monkeyd/vm"
+)
+
+// compiledExt - extension of serialized bytecode files
+const compiledExt = ".mkc"
+
+// buildCommand - monkeyd build [-o out.mkc] <file>
+func buildCommand(arguments []string) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	output := flags.String("o", "", "output file, defaults to the input with the .mkc extension")
+
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "monkeyd build: expected exactly one source file\n\n%s", usage)
+		return exitUsage
+	}
+
+	filename := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + compiledExt
+	}
+
+	source, program, ok := parseFile(os.Stderr, filename)
+	if !ok {
+		return exitError
+	}
+
+	bytecode, err := compileProgram(program)
+	if err != nil {
+		vm.FprintError(os.Stderr, filename, source, err)
+		return exitError
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkeyd: %s\n", err)
+		return exitError
+	}
+
+	err = compiler.WriteBytecode(out, bytecode)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkeyd: %s: %s\n", *output, err)
+		os.Remove(*output)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// execCommand - monkeyd exec <file.mkc> [args...]
+func execCommand(arguments []string) int {
+	if len(arguments) < 1 {
+		fmt.Fprintf(os.Stderr, "monkeyd exec: missing bytecode file\n\n%s", usage)
+		return exitUsage
+	}
+
+	bytecode, err := loadBytecode(arguments[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkeyd: %s\n", err)
+		return exitError
+	}
+
+	return runBytecode(os.Stderr, "", "", bytecode, newArgsArray(arguments[1:]))
+}
+
+func loadBytecode(filename string) (*compiler.Bytecode, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bytecode, err := compiler.ReadBytecode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return bytecode, nil
+}
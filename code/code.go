@@ -52,6 +52,10 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
 
+// Version - version of the opcode set, stored in serialized bytecode,
+// bump it whenever an opcode is added, removed or its operands change
+const Version = 11
+
 // Opcode - one byte wide
 // has a unique value
 // first byte in the instruction
@@ -106,6 +110,45 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+
+	OpConcat // pop the operands and push the concatenation of their display forms
+
+	OpMod
+	OpGreaterThanOrEqual
+	OpJumpTruthy
+
+	// Bitwise operations on integers
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpBitNot
+	OpShiftLeft
+	OpShiftRight
+
+	// Variables captured by closures live in shared cells
+	OpSetFree
+	OpCaptureLocal // push the cell of a local, boxing it on first capture
+	OpCaptureFree  // push the cell of a free variable to close over it again
+
+	OpSetIndex  // pop the value, index and collection, store the value and push it
+	OpIndexKeep // push collection[index], keeping both on the stack for OpSetIndex
+
+	// Loops
+	OpClearLocal // drop what a block local slot holds, the cell of an earlier iteration
+	OpIter       // pop an array or a string and push an iterator over it
+	OpIterNext   // pop an iterator, push its next element or jump when it is exhausted
+
+	// Destructuring
+	OpRest // pop an array or a string and push its elements from the operand on
+
+	// Parameters and arguments
+	OpDefault    // jump over the default value of a parameter when its argument was passed
+	OpCallSpread // call with the elements of the arrays on the stack as the arguments
+
+	OpLessThan
+	OpLessThanOrEqual
+
+	OpCallNamed // call like OpCallSpread, followed by name and value pairs of named arguments
 )
 
 type Definition struct {
@@ -242,6 +285,103 @@ var definitions = map[Opcode]*Definition{
 		Name:          "OpCurrentClosure",
 		OperandWidths: []int{},
 	},
+	OpConcat: &Definition{
+		Name:          "OpConcat",
+		OperandWidths: []int{2}, // number of values to concatenate
+	},
+	OpMod: &Definition{
+		Name:          "OpMod",
+		OperandWidths: []int{},
+	},
+	OpGreaterThanOrEqual: &Definition{
+		Name:          "OpGreaterThanOrEqual",
+		OperandWidths: []int{},
+	},
+	// not false and not null
+	OpJumpTruthy: &Definition{
+		Name:          "OpJumpTruthy",
+		OperandWidths: []int{2},
+	},
+	OpBitAnd: &Definition{
+		Name:          "OpBitAnd",
+		OperandWidths: []int{},
+	},
+	OpBitOr: &Definition{
+		Name:          "OpBitOr",
+		OperandWidths: []int{},
+	},
+	OpBitXor: &Definition{
+		Name:          "OpBitXor",
+		OperandWidths: []int{},
+	},
+	OpBitNot: &Definition{
+		Name:          "OpBitNot",
+		OperandWidths: []int{},
+	},
+	OpShiftLeft: &Definition{
+		Name:          "OpShiftLeft",
+		OperandWidths: []int{},
+	},
+	OpShiftRight: &Definition{
+		Name:          "OpShiftRight",
+		OperandWidths: []int{},
+	},
+	OpSetFree: &Definition{
+		Name:          "OpSetFree",
+		OperandWidths: []int{1},
+	},
+	OpCaptureLocal: &Definition{
+		Name:          "OpCaptureLocal",
+		OperandWidths: []int{1},
+	},
+	OpCaptureFree: &Definition{
+		Name:          "OpCaptureFree",
+		OperandWidths: []int{1},
+	},
+	OpSetIndex: &Definition{
+		Name:          "OpSetIndex",
+		OperandWidths: []int{},
+	},
+	OpIndexKeep: &Definition{
+		Name:          "OpIndexKeep",
+		OperandWidths: []int{},
+	},
+	OpClearLocal: &Definition{
+		Name:          "OpClearLocal",
+		OperandWidths: []int{1},
+	},
+	OpIter: &Definition{
+		Name:          "OpIter",
+		OperandWidths: []int{},
+	},
+	OpIterNext: &Definition{
+		Name:          "OpIterNext",
+		OperandWidths: []int{2}, // jump target once the iterator is exhausted
+	},
+	OpRest: &Definition{
+		Name:          "OpRest",
+		OperandWidths: []int{2}, // index of the first element
+	},
+	OpDefault: &Definition{
+		Name:          "OpDefault",
+		OperandWidths: []int{1, 2}, // parameter index, jump target when it was passed
+	},
+	OpCallSpread: &Definition{
+		Name:          "OpCallSpread",
+		OperandWidths: []int{1}, // number of arrays holding the arguments
+	},
+	OpLessThan: &Definition{
+		Name:          "OpLessThan",
+		OperandWidths: []int{},
+	},
+	OpLessThanOrEqual: &Definition{
+		Name:          "OpLessThanOrEqual",
+		OperandWidths: []int{},
+	},
+	OpCallNamed: &Definition{
+		Name:          "OpCallNamed",
+		OperandWidths: []int{1, 1}, // number of arrays holding the positional arguments, number of named ones
+	},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -95,6 +95,7 @@ func TestReadOperands(t *testing.T) {
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpDefault, []int{255, 65535}, 3},
 	}
 
 	for _, tt := range tests {
@@ -117,3 +118,46 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestLineTable(t *testing.T) {
+	var lines LineTable
+	lines = lines.Add(0, 1)
+	lines = lines.Add(3, 1)
+	lines = lines.Add(6, 2)
+	lines = lines.Add(9, 0)
+	lines = lines.Add(9, 4)
+	lines = lines.Add(12, 5)
+	lines = lines.Truncate(12)
+
+	expected := LineTable{{Offset: 0, Line: 1}, {Offset: 6, Line: 2}, {Offset: 9, Line: 4}}
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong entries. want=%v, got=%v", expected, lines)
+	}
+
+	for i, e := range expected {
+		if lines[i] != e {
+			t.Errorf("wrong entry %d. want=%v, got=%v", i, e, lines[i])
+		}
+	}
+
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1},
+		{5, 1},
+		{6, 2},
+		{8, 2},
+		{100, 4},
+	}
+
+	for _, tt := range tests {
+		if line := lines.Line(tt.offset); line != tt.expected {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d", tt.offset, tt.expected, line)
+		}
+	}
+
+	if line := LineTable(nil).Line(0); line != 0 {
+		t.Errorf("empty table should have no lines. got=%d", line)
+	}
+}
@@ -0,0 +1,51 @@
+package code
+
+import "sort"
+
+// LineEntry - the instructions from Offset up to the
+// next entry were compiled from the source Line
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// LineTable - maps instruction offsets back to source lines,
+// the entries are sorted by offset
+type LineTable []LineEntry
+
+// Add - record that the instruction at offset belongs to line,
+// consecutive instructions of the same line share one entry
+func (lt LineTable) Add(offset, line int) LineTable {
+	if line <= 0 {
+		return lt
+	}
+
+	if n := len(lt); n > 0 {
+		if lt[n-1].Line == line {
+			return lt
+		}
+
+		if lt[n-1].Offset == offset {
+			lt[n-1].Line = line
+			return lt
+		}
+	}
+
+	return append(lt, LineEntry{Offset: offset, Line: line})
+}
+
+// Truncate - drop the entries of instructions at or after offset
+func (lt LineTable) Truncate(offset int) LineTable {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset >= offset })
+	return lt[:i]
+}
+
+// Line - source line of the instruction at offset, 0 if unknown
+func (lt LineTable) Line(offset int) int {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+
+	return lt[i-1].Line
+}
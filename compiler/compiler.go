@@ -1,11 +1,11 @@
 package compiler
 
 import (
-	"fmt"
 	"sort"
 
 	"github.com/ioanzicu/monkeyd/ast"
 	"github.com/ioanzicu/monkeyd/code"
+	"github.com/ioanzicu/monkeyd/diagnostic"
 	"github.com/ioanzicu/monkeyd/object"
 )
 
@@ -16,8 +16,33 @@ type EmittedInstruction struct {
 
 type CompilationScope struct {
 	instructions        code.Instructions
+	lines               code.LineTable
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	loops []loopJumps // loops being compiled, the innermost last
+
+	// values the emitted instructions leave on the stack, counted
+	// along the instructions as if no jump was taken
+	height int
+}
+
+// loopJumps - positions of the `OpJump`s emitted for `break` and
+// `continue`, patched once the loop is compiled
+type loopJumps struct {
+	breaks    []int
+	continues []int
+
+	height int // stack height of the body, the jumps pop down to it
+}
+
+// compoundOperators - opcode that combines the old value
+// with the right side of a compound assignment
+var compoundOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
 }
 
 type Compiler struct {
@@ -27,6 +52,8 @@ type Compiler struct {
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	line int // source line of the node being compiled
 }
 
 func New() *Compiler {
@@ -58,7 +85,20 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// Compile - translate the node into bytecode, a failure
+// is reported as a *diagnostic.Diagnostic pointing at the node
 func (c *Compiler) Compile(node ast.Node) error {
+	if node == nil {
+		return nil
+	}
+
+	// attribute the emitted instructions to the innermost node
+	if line := node.Pos().Line; line > 0 {
+		outerLine := c.line
+		c.line = line
+		defer func() { c.line = outerLine }()
+	}
+
 	switch node := node.(type) {
 
 	case *ast.Program:
@@ -79,21 +119,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.InfixExpression:
-		// 1 < 2 -> 2 > 1
-		// invert the order of the expression for '<'
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-
-			c.emit(code.OpGreaterThan)
-			return nil
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
 		}
 
 		err := c.Compile(node.Left)
@@ -115,24 +142,59 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return diagnostic.Errorf(
+				diagnostic.UnknownOperator,
+				diagnostic.SpanOf(node),
+				"unknown operator %s", node.Operator,
+			)
 		}
 
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(integer))
+		c.emit(code.OpConstant, c.addConstant(integerConstant(node)))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
 
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpConcat, len(node.Parts))
+
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -151,8 +213,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpBang)
 		case "-":
 			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return diagnostic.Errorf(
+				diagnostic.UnknownOperator,
+				diagnostic.SpanOf(node),
+				"unknown operator %s", node.Operator,
+			)
 		}
 
 	case *ast.IfExpression:
@@ -164,13 +232,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// Emit an `OpJumpNotTruthy` with a bogus value
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
 
-		err = c.Compile(node.Consequence)
+		err = c.compileBlock(node.Consequence)
 		if err != nil {
 			return err
 		}
 
+		// a block that does not end with an expression gives null
 		if c.lastInstructionIs(code.OpPop) {
 			c.removeLastPop()
+		} else {
+			c.emit(code.OpNull)
 		}
 
 		// Emit an `OpJump` with a bogus value
@@ -184,13 +255,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpNull)
 		} else {
 			// ELSE
-			err := c.Compile(node.Alternative)
+			err := c.compileBlock(node.Alternative)
 			if err != nil {
 				return err
 			}
 
 			if c.lastInstructionIs(code.OpPop) {
 				c.removeLastPop()
+			} else {
+				c.emit(code.OpNull)
 			}
 		}
 
@@ -198,6 +271,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
 
+		// only one of the branches leaves its value
+		c.scopes[c.scopeIndex].height--
+
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -207,22 +283,57 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+		err := c.checkRedefinition(node.Name)
 		if err != nil {
 			return err
 		}
 
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		return c.compileBinding(node.Name.Value, node.Value, false)
+
+	case *ast.ConstStatement:
+		err := c.checkRedefinition(node.Name)
+		if err != nil {
+			return err
+		}
+
+		if constIndex, ok := c.inlinedConstant(node.Value); ok {
+			c.symbolTable.DefineInlined(node.Name.Value, constIndex)
+			return nil
 		}
 
+		return c.compileBinding(node.Name.Value, node.Value, true)
+
+	case *ast.DestructureStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		return c.compilePattern(node.Pattern)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		return c.compileLoopControl(node)
+
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return diagnostic.Errorf(
+				diagnostic.UndefinedVariable,
+				diagnostic.SpanOf(node),
+				"undefined variable %s", node.Value,
+			)
 		}
 
 		c.loadSymbol(symbol)
@@ -287,7 +398,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.symbolTable.Define(p.Value)
 		}
 
-		err := c.Compile(node.Body)
+		if node.Rest != nil {
+			c.symbolTable.Define(node.Rest.Value)
+		}
+
+		err := c.compileDefaults(node)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -301,17 +421,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		freeSymbols := c.symbolTable.FreeSymbols
-		numLocals := c.symbolTable.numDefinitions
+		numLocals := c.symbolTable.numSlots
+		lines := c.scopes[c.scopeIndex].lines
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.captureSymbol(s)
+		}
+
+		numDefaults := 0
+		for i := range node.Parameters {
+			if node.Default(i) != nil {
+				numDefaults++
+			}
 		}
 
 		compiledFn := &object.CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
+			Instructions:   instructions,
+			NumLocals:      numLocals,
+			NumParameters:  len(node.Parameters),
+			NumDefaults:    numDefaults,
+			Variadic:       node.Rest != nil,
+			Name:           node.Name,
+			ParameterNames: parameterNames(node.Parameters),
+			Lines:          lines,
 		}
 
 		fnIndex := c.addConstant(compiledFn)
@@ -323,6 +456,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		if hasNamed(node.Arguments) {
+			return c.compileNamedArguments(node.Arguments)
+		}
+
+		if hasSpread(node.Arguments) {
+			return c.compileSpreadArguments(node.Arguments)
+		}
+
 		for _, arg := range node.Arguments {
 			err := c.Compile(arg)
 			if err != nil {
@@ -349,12 +490,18 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Globals:      c.symbolTable.globalNames(),
+		Lines:        c.scopes[c.scopeIndex].lines,
+		NumLocals:    c.symbolTable.frame().numSlots,
 	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object // that will be evaluated by the compiler
+	Globals      []string        // global binding names by index, for the disassembler
+	Lines        code.LineTable  // source lines of the main instructions
+	NumLocals    int             // slots of the locals defined in blocks of the main program
 }
 
 // addConstant - append the constant object and
@@ -364,11 +511,441 @@ func (c *Compiler) addConstant(obj object.Object) int {
 	return len(c.constants) - 1
 }
 
+// compileLogicalExpression - `&&` and `||` jump over the right
+// operand when the left one decides the result
+//
+//	a && b                          a || b
+//	  <a>                             <a>
+//	  OpJumpNotTruthy false           OpJumpTruthy true
+//	  <b>                             <b>
+//	  OpJumpNotTruthy false           OpJumpTruthy true
+//	  OpTrue                          OpFalse
+//	  OpJump end                      OpJump end
+//	false: OpFalse                  true: OpTrue
+//	end:                            end:
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	jump, decided, undecided := code.OpJumpNotTruthy, code.OpFalse, code.OpTrue
+	if node.Operator == "||" {
+		jump, decided, undecided = code.OpJumpTruthy, code.OpTrue, code.OpFalse
+	}
+
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+	leftJumpPos := c.emit(jump, 9999)
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	rightJumpPos := c.emit(jump, 9999)
+
+	c.emit(undecided)
+	endJumpPos := c.emit(code.OpJump, 9999)
+
+	decidedPos := len(c.currentInstructions())
+	c.changeOperand(leftJumpPos, decidedPos)
+	c.changeOperand(rightJumpPos, decidedPos)
+	c.emit(decided)
+
+	c.changeOperand(endJumpPos, len(c.currentInstructions()))
+
+	// only one of decided and undecided is pushed
+	c.scopes[c.scopeIndex].height--
+
+	return nil
+}
+
+// compileAssignExpression - leave the assigned value on the stack,
+// a compound assignment combines the old value with the right side
+//
+//	x += y                          a[i] += y
+//	  OpGetGlobal x                   <a>
+//	  <y>                             <i>
+//	  OpAdd                           OpIndexKeep
+//	  OpSetGlobal x                   <y>
+//	  OpGetGlobal x                   OpAdd
+//	                                  OpSetIndex
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	_, compound := compoundOperators[node.Operator]
+
+	switch target := node.Target.(type) {
+
+	case *ast.Identifier:
+		symbol, err := c.resolveAssignable(target)
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			c.loadSymbol(symbol)
+		}
+
+		err = c.compileAssignedValue(node)
+		if err != nil {
+			return err
+		}
+
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			c.emit(code.OpIndexKeep)
+		}
+
+		err = c.compileAssignedValue(node)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpSetIndex)
+
+	default:
+		return diagnostic.Errorf(
+			diagnostic.InvalidAssignment,
+			diagnostic.SpanOf(node.Target),
+			"cannot assign to %s", node.Target.String(),
+		)
+	}
+
+	return nil
+}
+
+// compileAssignedValue - the right side of the assignment, combined
+// with the old value already on the stack when it is compound
+func (c *Compiler) compileAssignedValue(node *ast.AssignExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	if op, ok := compoundOperators[node.Operator]; ok {
+		c.emit(op)
+	}
+
+	return nil
+}
+
+// resolveAssignable - the symbol of a variable that can be assigned
+func (c *Compiler) resolveAssignable(name *ast.Identifier) (Symbol, error) {
+	symbol, ok := c.symbolTable.ResolveAssignable(name.Value)
+	if !ok {
+		return symbol, diagnostic.Errorf(
+			diagnostic.UndefinedVariable,
+			diagnostic.SpanOf(name),
+			"undefined variable %s", name.Value,
+		)
+	}
+
+	origin := c.symbolTable.origin(symbol)
+	if origin.Const {
+		return symbol, diagnostic.Errorf(
+			diagnostic.ImmutableBinding,
+			diagnostic.SpanOf(name),
+			"cannot assign to constant %s", name.Value,
+		)
+	}
+
+	if origin.Scope == BuiltinScope {
+		return symbol, diagnostic.Errorf(
+			diagnostic.ImmutableBinding,
+			diagnostic.SpanOf(name),
+			"cannot assign to builtin %s", name.Value,
+		)
+	}
+
+	return symbol, nil
+}
+
+// compileWhileStatement - the body is a block scope of its own
+//
+//	start: <condition>
+//	       OpJumpNotTruthy exit
+//	       <body>
+//	       OpJump start
+//	exit:
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	startPos := len(c.currentInstructions())
+
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+	exitJumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	c.enterLoop()
+	err = c.compileBlock(node.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, startPos)
+
+	exitPos := len(c.currentInstructions())
+	c.changeOperand(exitJumpPos, exitPos)
+	c.leaveLoop(startPos, exitPos)
+
+	return nil
+}
+
+// compileForStatement - the init statement is in a block scope
+// around the loop, so its variables live across the iterations
+//
+//	       <init>
+//	start: <condition>
+//	       OpJumpNotTruthy exit
+//	       <body>
+//	post:  <post>
+//	       OpPop
+//	       OpJump start
+//	exit:
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	err := c.Compile(node.Init)
+	if err != nil {
+		return err
+	}
+
+	startPos := len(c.currentInstructions())
+	exitJumpPos := -1
+
+	if node.Condition != nil {
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+		exitJumpPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	c.enterLoop()
+	err = c.compileBlock(node.Body)
+	if err != nil {
+		return err
+	}
+
+	postPos := len(c.currentInstructions())
+	if node.Post != nil {
+		err := c.Compile(node.Post)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpJump, startPos)
+
+	exitPos := len(c.currentInstructions())
+	if exitJumpPos >= 0 {
+		c.changeOperand(exitJumpPos, exitPos)
+	}
+	c.leaveLoop(postPos, exitPos)
+
+	return nil
+}
+
+// compileForInStatement - the iterator is kept in a local slot of
+// the loop scope, the variable gets a fresh one every iteration
+//
+//	       <iterable>
+//	       OpIter
+//	       OpClearLocal iterator
+//	       OpSetLocal iterator
+//	start: OpGetLocal iterator
+//	       OpIterNext exit
+//	       OpClearLocal variable
+//	       OpSetLocal variable
+//	       <body>
+//	       OpJump start
+//	exit:
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	// the name can not be written in the source
+	iterator := c.defineLocal("", false)
+
+	startPos := len(c.currentInstructions())
+	c.loadSymbol(iterator)
+	exitJumpPos := c.emit(code.OpIterNext, 9999)
+
+	c.enterBlock()
+	c.defineLocal(node.Variable.Value, false)
+	c.enterLoop()
+
+	for _, s := range node.Body.Statements {
+		err := c.Compile(s)
+		if err != nil {
+			return err
+		}
+	}
+	c.leaveBlock()
+	c.emit(code.OpJump, startPos)
+
+	exitPos := len(c.currentInstructions())
+	c.changeOperand(exitJumpPos, exitPos)
+	c.leaveLoop(startPos, exitPos)
+
+	return nil
+}
+
+// compileBlock - the block in a scope of its own, the names
+// it defines are gone once it ends and their slots are reused
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	return c.Compile(block)
+}
+
+// compileLoopControl - an `OpJump` patched by leaveLoop, after
+// popping what the enclosing expressions left on the stack, like
+// the 1 and 2 of [1, 2, if (x) { break; }]
+func (c *Compiler) compileLoopControl(node ast.Node) error {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return diagnostic.Errorf(
+			diagnostic.MisplacedLoopControl,
+			diagnostic.SpanOf(node),
+			"%s outside of a loop", node.TokenLiteral(),
+		)
+	}
+
+	loop := &loops[len(loops)-1]
+
+	// the code after the jump is compiled as if it was not taken
+	height := c.scopes[c.scopeIndex].height
+	for range height - loop.height {
+		c.emit(code.OpPop)
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.scopes[c.scopeIndex].height = height
+
+	if _, ok := node.(*ast.BreakStatement); ok {
+		loop.breaks = append(loop.breaks, jumpPos)
+	} else {
+		loop.continues = append(loop.continues, jumpPos)
+	}
+
+	return nil
+}
+
+func (c *Compiler) enterLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, loopJumps{height: scope.height})
+}
+
+// leaveLoop - point the `continue`s of the innermost loop
+// at continuePos and its `break`s at breakPos
+func (c *Compiler) leaveLoop(continuePos, breakPos int) {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, continuePos)
+	}
+
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, breakPos)
+	}
+}
+
+// checkRedefinition - a const can not be defined again in its
+// own scope, an inner scope can shadow it
+func (c *Compiler) checkRedefinition(name *ast.Identifier) error {
+	if c.symbolTable.definesConst(name.Value) {
+		return diagnostic.Errorf(
+			diagnostic.ImmutableBinding,
+			diagnostic.SpanOf(name),
+			"cannot redefine constant %s", name.Value,
+		)
+	}
+
+	return nil
+}
+
+// inlinedConstant - index in the constant pool of the value of a const
+// known at compile time: a number or a string literal, a negated
+// number or another inlined const
+func (c *Compiler) inlinedConstant(node ast.Expression) (int, bool) {
+	var value object.Object
+
+	switch node := node.(type) {
+
+	case *ast.IntegerLiteral:
+		value = integerConstant(node)
+
+	case *ast.FloatLiteral:
+		value = &object.Float{Value: node.Value}
+
+	case *ast.StringLiteral:
+		value = &object.String{Value: node.Value}
+
+	case *ast.PrefixExpression:
+		if node.Operator != "-" {
+			return 0, false
+		}
+
+		switch right := node.Right.(type) {
+		case *ast.IntegerLiteral:
+			value = object.NegateInteger(integerConstant(right))
+		case *ast.FloatLiteral:
+			value = &object.Float{Value: -right.Value}
+		default:
+			return 0, false
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if ok && symbol.Scope == ConstantScope {
+			return symbol.Index, true
+		}
+		return 0, false
+
+	default:
+		return 0, false
+	}
+
+	return c.addConstant(value), true
+}
+
+func integerConstant(node *ast.IntegerLiteral) object.Object {
+	if node.Big != nil {
+		return &object.BigInt{Value: node.Big}
+	}
+
+	return &object.Integer{Value: node.Value}
+}
+
 // emit - returns the starting position of the just-emitted instruction
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 
+	scope := &c.scopes[c.scopeIndex]
+	scope.lines = scope.lines.Add(pos, c.line)
+
+	pops, pushes := stackEffect(op, operands)
+	scope.height += pushes - pops
+
 	c.setLastInstruction(op, pos)
 
 	return pos
@@ -407,7 +984,9 @@ func (c *Compiler) removeLastPop() {
 	new := old[:last.Position]
 
 	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Truncate(last.Position)
 	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.scopes[c.scopeIndex].height++ // the value is kept
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
@@ -452,6 +1031,265 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 }
 
+// compileBinding - the value of a let or a const is compiled before
+// the name is defined, so it sees the binding the name shadows:
+// let x = x + 1. A function is bound first instead, an assignment
+// to its name in its body then targets the new binding
+func (c *Compiler) compileBinding(name string, value ast.Expression, constant bool) error {
+	if fn, ok := value.(*ast.FunctionLiteral); ok && fn.Name == name {
+		symbol := c.declareLocal(name, constant)
+
+		err := c.Compile(value)
+		if err != nil {
+			return err
+		}
+
+		c.storeSymbol(symbol)
+		return nil
+	}
+
+	err := c.Compile(value)
+	if err != nil {
+		return err
+	}
+
+	c.defineLocal(name, constant)
+	return nil
+}
+
+// defineLocal - define the name and store the value on top of the
+// stack in it
+func (c *Compiler) defineLocal(name string, constant bool) Symbol {
+	symbol := c.declareLocal(name, constant)
+	c.storeSymbol(symbol)
+	return symbol
+}
+
+// declareLocal - define the name without storing a value in it. A
+// slot a block used before, or an earlier iteration of a loop, may
+// still hold a cell shared with a closure created then, it is
+// cleared so the value is not written through it
+func (c *Compiler) declareLocal(name string, constant bool) Symbol {
+	define := c.symbolTable.Define
+	if constant {
+		define = c.symbolTable.DefineConst
+	}
+
+	usedSlots := c.symbolTable.frame().numSlots
+	symbol := define(name)
+
+	if symbol.Scope == LocalScope && (c.symbolTable.block || symbol.Index < usedSlots) {
+		c.emit(code.OpClearLocal, symbol.Index)
+	}
+
+	return symbol
+}
+
+// compileDefaults - the default value of a parameter is computed at
+// the call, when no argument was passed for it, in the scope of the
+// function so it sees the parameters before it
+func (c *Compiler) compileDefaults(node *ast.FunctionLiteral) error {
+	for i := range node.Parameters {
+		def := node.Default(i)
+		if def == nil {
+			continue
+		}
+
+		// the operand to jump over the value is set once it is compiled
+		defaultPos := c.emit(code.OpDefault, i, 9999)
+
+		err := c.Compile(def)
+		if err != nil {
+			return err
+		}
+
+		// the parameters take the first local slots
+		c.emit(code.OpSetLocal, i)
+
+		c.replaceInstruction(defaultPos, code.Make(code.OpDefault, i, len(c.currentInstructions())))
+	}
+
+	return nil
+}
+
+func hasSpread(args []ast.Expression) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasNamed(args []ast.Expression) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*ast.NamedArgument); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parameterNames(parameters []*ast.Identifier) []string {
+	names := make([]string, len(parameters))
+	for i, param := range parameters {
+		names[i] = param.Value
+	}
+
+	return names
+}
+
+// compileSpreadArguments - OpCallSpread passes the elements of the
+// arrays of arguments
+func (c *Compiler) compileSpreadArguments(args []ast.Expression) error {
+	numArrays, err := c.compileArgumentArrays(args)
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpCallSpread, numArrays)
+	return nil
+}
+
+// compileNamedArguments - the positional arguments go in arrays like
+// spread ones, each named argument after them is its name followed
+// by its value, and the VM matches the names to the parameters
+func (c *Compiler) compileNamedArguments(args []ast.Expression) error {
+	first := len(args)
+	for i, arg := range args {
+		if _, ok := arg.(*ast.NamedArgument); ok {
+			first = i
+			break
+		}
+	}
+
+	numArrays, err := c.compileArgumentArrays(args[:first])
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args[first:] {
+		named := arg.(*ast.NamedArgument)
+
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: named.Name.Value}))
+
+		err := c.Compile(named.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpCallNamed, numArrays, len(args)-first)
+	return nil
+}
+
+// compileArgumentArrays - every spread value is an array of arguments,
+// the arguments between them are gathered in arrays of their own.
+// Returns the number of arrays
+func (c *Compiler) compileArgumentArrays(args []ast.Expression) (int, error) {
+	numArrays, grouped := 0, 0
+
+	for _, arg := range args {
+		spread, ok := arg.(*ast.SpreadExpression)
+		if !ok {
+			err := c.Compile(arg)
+			if err != nil {
+				return 0, err
+			}
+
+			grouped++
+			continue
+		}
+
+		if grouped > 0 {
+			c.emit(code.OpArray, grouped)
+			numArrays, grouped = numArrays+1, 0
+		}
+
+		err := c.Compile(spread.Value)
+		if err != nil {
+			return 0, err
+		}
+		numArrays++
+	}
+
+	if grouped > 0 {
+		c.emit(code.OpArray, grouped)
+		numArrays++
+	}
+
+	return numArrays, nil
+}
+
+// compilePattern - bind the names of the pattern to the parts of the
+// value on top of the stack. The value is kept in a hidden local and
+// each part is taken from it with OpIndex, like `value[i]` would be
+func (c *Compiler) compilePattern(pattern ast.Pattern) error {
+	if name, ok := pattern.(*ast.Identifier); ok {
+		err := c.checkRedefinition(name)
+		if err != nil {
+			return err
+		}
+
+		c.defineLocal(name.Value, false)
+		return nil
+	}
+
+	value := c.defineLocal("", false)
+
+	switch pattern := pattern.(type) {
+
+	case *ast.ArrayPattern:
+		for i, element := range pattern.Elements {
+			c.loadSymbol(value)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(code.OpIndex)
+
+			err := c.compilePattern(element)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil {
+			c.loadSymbol(value)
+			c.emit(code.OpRest, len(pattern.Elements))
+
+			err := c.compilePattern(pattern.Rest)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			c.loadSymbol(value)
+			c.emit(code.OpConstant, c.addConstant(&object.String{Value: pair.Key.Value}))
+			c.emit(code.OpIndex)
+
+			err := c.compilePattern(pair.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
+// enterBlock - a scope for the names defined in a block,
+// they take local slots of the current frame
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
@@ -477,5 +1315,41 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	case FunctionScope:
 		c.emit(code.OpCurrentClosure)
 
+	case ConstantScope:
+		c.emit(code.OpConstant, s.Index)
+
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+
+	}
+}
+
+// captureSymbol - push the cell of a variable a new closure is
+// closed over, so the closure shares it with the enclosing scope
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+
+	default:
+		// the enclosing function itself, it can not be reassigned
+		c.loadSymbol(s)
+
 	}
 }
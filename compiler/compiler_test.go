@@ -2,10 +2,12 @@ package compiler
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ioanzicu/monkeyd/ast"
 	"github.com/ioanzicu/monkeyd/code"
+	"github.com/ioanzicu/monkeyd/diagnostic"
 	"github.com/ioanzicu/monkeyd/lexer"
 	"github.com/ioanzicu/monkeyd/object"
 	"github.com/ioanzicu/monkeyd/parser"
@@ -204,6 +206,57 @@ func testStringObject(expected string, acutal object.Object) error {
 	return nil
 }
 
+func TestModulo(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "7 % 3",
+			expectedConstants: []interface{}{7, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMod),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 & 2 | 3 ^ 4",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpBitAnd),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpBitOr),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpBitXor),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "~1 << 2 >> 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpShiftLeft),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpShiftRight),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -234,11 +287,11 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				code.Make(code.OpPop),
 			},
 		},
@@ -291,6 +344,77 @@ func TestBooleanExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "1 >= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 <= 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThanOrEqual),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpNotTruthy, 12),
+				// 0008
+				code.Make(code.OpTrue),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpFalse),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "true || false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpTruthy, 12),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpTruthy, 12),
+				// 0008
+				code.Make(code.OpFalse),
+				// 0009
+				code.Make(code.OpJump, 13),
+				// 0012
+				code.Make(code.OpTrue),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -342,6 +466,30 @@ func TestConditionals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `if (true) { } else { let a = 1; };`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 8),
+				// 0004
+				code.Make(code.OpNull),
+				// 0005
+				code.Make(code.OpJump, 16),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpClearLocal, 0),
+				// 0013
+				code.Make(code.OpSetLocal, 0),
+				// 0015
+				code.Make(code.OpNull),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -416,6 +564,18 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `"one ${1} two ${true}"`,
+			expectedConstants: []interface{}{"one ", 1, " two "},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpTrue),
+				code.Make(code.OpConcat, 4),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -545,6 +705,42 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestIndexAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = [1]; a[0] = 2",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let h = {}; h["n"] *= 3`,
+			expectedConstants: []interface{}{"n", 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndexKeep),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -901,7 +1097,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -931,13 +1127,13 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -985,15 +1181,15 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -1010,67 +1206,105 @@ func TestClosures(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
-func TestRecursiveFunctions(t *testing.T) {
+func TestAssignments(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input: `
-			let countDown = fn(x) { countDown(x - 1); }
-			countDown(1);
+			let x = 1;
+			x += 2;
+			`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() {
+				let x = 1;
+				x = 2
+			}
 			`,
 			expectedConstants: []interface{}{
 				1,
+				2,
 				[]code.Instructions{
-					code.Make(code.OpCurrentClosure),
-					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpConstant, 0),
-					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 1, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpCall, 1),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
 		{
 			input: `
-			let wrapper = fn() {
-				let countDown = fn(x) { countDown(x - 1); };
-				countDown(1);
-			};
-			wrapper();
+			fn() {
+				let x = 0;
+				fn() { x -= 1 }
+			}
 			`,
 			expectedConstants: []interface{}{
+				0,
 				1,
 				[]code.Instructions{
-					code.Make(code.OpCurrentClosure),
-					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSub),
-					code.Make(code.OpCall, 1),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
 					code.Make(code.OpReturnValue),
 				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			fn() {
+				let f = fn() { f = 1 };
+				f
+			}
+			`,
+			expectedConstants: []interface{}{
 				1,
 				[]code.Instructions{
-					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 2),
-					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 3, 0),
-				code.Make(code.OpSetGlobal, 0),
-				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpCall, 0),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpPop),
 			},
 		},
@@ -1078,3 +1312,666 @@ func TestRecursiveFunctions(t *testing.T) {
 
 	runCompilerTests(t, tests)
 }
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let i = 0; while (i < 3) { i += 1; }`,
+			expectedConstants: []interface{}{0, 3, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThan),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 33),
+				// 0016
+				code.Make(code.OpGetGlobal, 0),
+				// 0019
+				code.Make(code.OpConstant, 2),
+				// 0022
+				code.Make(code.OpAdd),
+				// 0023
+				code.Make(code.OpSetGlobal, 0),
+				// 0026
+				code.Make(code.OpGetGlobal, 0),
+				// 0029
+				code.Make(code.OpPop),
+				// 0030
+				code.Make(code.OpJump, 6),
+			},
+		},
+		{
+			input:             `while (true) { break; continue; }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.Make(code.OpJump, 13),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpJump, 0),
+			},
+		},
+		{
+			input:             `for (x in [1]) { x }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIter),
+				// 0007
+				code.Make(code.OpClearLocal, 0),
+				// 0009
+				code.Make(code.OpSetLocal, 0),
+				// 0011
+				code.Make(code.OpGetLocal, 0),
+				// 0013
+				code.Make(code.OpIterNext, 26),
+				// 0016
+				code.Make(code.OpClearLocal, 1),
+				// 0018
+				code.Make(code.OpSetLocal, 1),
+				// 0020
+				code.Make(code.OpGetLocal, 1),
+				// 0022
+				code.Make(code.OpPop),
+				// 0023
+				code.Make(code.OpJump, 11),
+			},
+		},
+		{
+			input: `fn() { for (let i = 0; i < 2; i += 1) { let j = i; } }`,
+			expectedConstants: []interface{}{
+				0,
+				2,
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpConstant, 0),
+					// 0003
+					code.Make(code.OpClearLocal, 0),
+					// 0005
+					code.Make(code.OpSetLocal, 0),
+					// 0007
+					code.Make(code.OpGetLocal, 0),
+					// 0009
+					code.Make(code.OpConstant, 1),
+					// 0012
+					code.Make(code.OpLessThan),
+					// 0013
+					code.Make(code.OpJumpNotTruthy, 36),
+					// 0016
+					code.Make(code.OpGetLocal, 0),
+					// 0018
+					code.Make(code.OpClearLocal, 1),
+					// 0020
+					code.Make(code.OpSetLocal, 1),
+					// 0022
+					code.Make(code.OpGetLocal, 0),
+					// 0024
+					code.Make(code.OpConstant, 2),
+					// 0027
+					code.Make(code.OpAdd),
+					// 0028
+					code.Make(code.OpSetLocal, 0),
+					// 0030
+					code.Make(code.OpGetLocal, 0),
+					// 0032
+					code.Make(code.OpPop),
+					// 0033
+					code.Make(code.OpJump, 7),
+					// 0036
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { while (true) { fn() { while (true) { break; } }; break; } }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 10),
+					// 0004
+					code.Make(code.OpJump, 10),
+					// 0007
+					code.Make(code.OpJump, 0),
+					// 0010
+					code.Make(code.OpReturn),
+				},
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpTrue),
+					// 0001
+					code.Make(code.OpJumpNotTruthy, 15),
+					// 0004
+					code.Make(code.OpClosure, 0, 0),
+					// 0008
+					code.Make(code.OpPop),
+					// 0009
+					code.Make(code.OpJump, 15),
+					// 0012
+					code.Make(code.OpJump, 0),
+					// 0015
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestBlockLetStatementScopes(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// the branches share a slot, reused after the if
+			input: `
+			fn() {
+				let a = 1;
+				if (a) { let b = 2; b } else { let c = 3; c };
+				let d = 4;
+			}
+			`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				3,
+				4,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpConstant, 0),
+					// 0003
+					code.Make(code.OpSetLocal, 0),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpJumpNotTruthy, 22),
+					// 0010
+					code.Make(code.OpConstant, 1),
+					// 0013
+					code.Make(code.OpClearLocal, 1),
+					// 0015
+					code.Make(code.OpSetLocal, 1),
+					// 0017
+					code.Make(code.OpGetLocal, 1),
+					// 0019
+					code.Make(code.OpJump, 31),
+					// 0022
+					code.Make(code.OpConstant, 2),
+					// 0025
+					code.Make(code.OpClearLocal, 1),
+					// 0027
+					code.Make(code.OpSetLocal, 1),
+					// 0029
+					code.Make(code.OpGetLocal, 1),
+					// 0031
+					code.Make(code.OpPop),
+					// 0032
+					code.Make(code.OpConstant, 3),
+					// 0035
+					code.Make(code.OpClearLocal, 1),
+					// 0037
+					code.Make(code.OpSetLocal, 1),
+					// 0039
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the value still sees the global the let shadows
+			input:             `let x = 1; if (true) { let x = x + 1; x }`,
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpTrue),
+				// 0007
+				code.Make(code.OpJumpNotTruthy, 26),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				// 0013
+				code.Make(code.OpConstant, 1),
+				// 0016
+				code.Make(code.OpAdd),
+				// 0017
+				code.Make(code.OpClearLocal, 0),
+				// 0019
+				code.Make(code.OpSetLocal, 0),
+				// 0021
+				code.Make(code.OpGetLocal, 0),
+				// 0023
+				code.Make(code.OpJump, 27),
+				// 0026
+				code.Make(code.OpNull),
+				// 0027
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `const A = 5; const B = A; A + B`,
+			expectedConstants: []interface{}{5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// an inlined constant is not a free variable of the closure
+			input: `const N = -2; fn() { N }`,
+			expectedConstants: []interface{}{
+				-2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `const A = [1]; A`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `const A = 1; if (true) { const A = 2; A }`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 1),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructureStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let [a, ...b] = [1, 2];`,
+			expectedConstants: []interface{}{1, 2, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpRest, 1),
+				code.Make(code.OpSetGlobal, 2),
+			},
+		},
+		{
+			// every nested pattern keeps its value in a local of its own
+			input: `fn(p) { let {x: [y]} = p; }`,
+			expectedConstants: []interface{}{
+				"x",
+				0,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetLocal, 3),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDefaultParametersAndSpreadArguments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b = a) { b }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpDefault, 1, 8),
+					// 0004
+					code.Make(code.OpGetLocal, 0),
+					// 0006
+					code.Make(code.OpSetLocal, 1),
+					// 0008
+					code.Make(code.OpGetLocal, 1),
+					// 0010
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the rest parameter takes the local after the parameters
+			input: `fn(a, ...b) { b }`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `len(1, ...[2, 3], 4, 5)`,
+			expectedConstants: []interface{}{1, 2, 3, 4, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpCallSpread, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the positional arguments go in arrays, each named one
+			// is its name followed by its value
+			input:             `len(1, b: 2, a: 3)`,
+			expectedConstants: []interface{}{1, "b", 2, "a", 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpCallNamed, 1, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	program := parse(`fn(a, b = 1, c = 2, ...d) { }`)
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn := compiler.Bytecode().Constants[2].(*object.CompiledFunction)
+	if fn.NumParameters != 3 || fn.NumDefaults != 2 || !fn.Variadic || fn.NumLocals != 4 {
+		t.Errorf("wrong function metadata. got NumParameters=%d NumDefaults=%d Variadic=%t NumLocals=%d",
+			fn.NumParameters, fn.NumDefaults, fn.Variadic, fn.NumLocals)
+	}
+
+	if strings.Join(fn.ParameterNames, ",") != "a,b,c" {
+		t.Errorf("wrong parameter names. got=%q", fn.ParameterNames)
+	}
+}
+
+func TestMainProgramLocals(t *testing.T) {
+	tests := []struct {
+		input             string
+		expectedNumLocals int
+	}{
+		{`let a = 1; a`, 0},
+		{`while (false) { let a = 1; let b = 2; }`, 2},
+		{`for (x in []) { } for (let i = 0; i < 1; i += 1) { }`, 2},
+		{`fn() { for (x in []) { let y = x; } }`, 0},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		if got := compiler.Bytecode().NumLocals; got != tt.expectedNumLocals {
+			t.Errorf("input %q - wrong NumLocals. want=%d, got=%d", tt.input, tt.expectedNumLocals, got)
+		}
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			let countDown = fn(x) { countDown(x - 1); }
+			countDown(1);
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) { countDown(x - 1); };
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				[]code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompilerDiagnostics(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedCode    diagnostic.Code
+		expectedMessage string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let a = 1;\na + b;", diagnostic.UndefinedVariable, "undefined variable b", 2, 5},
+		{"fn() { x }", diagnostic.UndefinedVariable, "undefined variable x", 1, 8},
+		{"x = 1;", diagnostic.UndefinedVariable, "undefined variable x", 1, 1},
+		{"len += 1;", diagnostic.ImmutableBinding, "cannot assign to builtin len", 1, 1},
+		{"const f = fn() { f = 1 };", diagnostic.ImmutableBinding, "cannot assign to constant f", 1, 18},
+		{"fn() { const f = fn() { fn() { f += 1 } } };", diagnostic.ImmutableBinding, "cannot assign to constant f", 1, 32},
+		{"continue;", diagnostic.MisplacedLoopControl, "continue outside of a loop", 1, 1},
+		{"if (true) { let a = 1; }; a", diagnostic.UndefinedVariable, "undefined variable a", 1, 27},
+		{"fn() { while (true) { let a = 1; } a }", diagnostic.UndefinedVariable, "undefined variable a", 1, 36},
+		{"const a = 1;\na = 2;", diagnostic.ImmutableBinding, "cannot assign to constant a", 2, 1},
+		{"const a = [];\na += [1];", diagnostic.ImmutableBinding, "cannot assign to constant a", 2, 1},
+		{"const a = [];\nfn() { fn() { a = 1 } }", diagnostic.ImmutableBinding, "cannot assign to constant a", 2, 15},
+		{"fn(x) { const a = x; a = 1 }", diagnostic.ImmutableBinding, "cannot assign to constant a", 1, 22},
+		{"const a = 1;\nconst a = 2;", diagnostic.ImmutableBinding, "cannot redefine constant a", 2, 7},
+		{"const a = 1;\nlet a = 2;", diagnostic.ImmutableBinding, "cannot redefine constant a", 2, 5},
+		{"const a = 1;\nlet [b, {c: a}] = [];", diagnostic.ImmutableBinding, "cannot redefine constant a", 2, 13},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("input %q - expected compiler error, got none", tt.input)
+		}
+
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Fatalf("input %q - error is not *diagnostic.Diagnostic. got=%T", tt.input, err)
+		}
+
+		if d.Code != tt.expectedCode {
+			t.Errorf("input %q - wrong code. want=%s, got=%s", tt.input, tt.expectedCode, d.Code)
+		}
+		if d.Message != tt.expectedMessage {
+			t.Errorf("input %q - wrong message. want=%q, got=%q", tt.input, tt.expectedMessage, d.Message)
+		}
+		if d.Span.Start.Line != tt.expectedLine || d.Span.Start.Column != tt.expectedColumn {
+			t.Errorf("input %q - wrong position. want=%d:%d, got=%s",
+				tt.input, tt.expectedLine, tt.expectedColumn, d.Span.Start)
+		}
+	}
+}
+
+func TestLineTables(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a +
+    b
+};
+add(1,
+  2);`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	// OpClosure, OpSetGlobal, OpGetGlobal, OpConstant, OpConstant, OpCall, OpPop
+	expectedMain := code.LineTable{
+		{Offset: 0, Line: 1},
+		{Offset: 7, Line: 5},
+		{Offset: 13, Line: 6},
+		{Offset: 16, Line: 5},
+	}
+	if fmt.Sprint(bytecode.Lines) != fmt.Sprint(expectedMain) {
+		t.Errorf("wrong main lines. want=%v, got=%v", expectedMain, bytecode.Lines)
+	}
+
+	fn, ok := bytecode.Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 0 is not a function. got=%T", bytecode.Constants[0])
+	}
+
+	if fn.Name != "add" {
+		t.Errorf("wrong function name. want=%q, got=%q", "add", fn.Name)
+	}
+
+	// OpGetLocal 0, OpGetLocal 1, OpAdd, OpReturnValue
+	expectedFn := code.LineTable{
+		{Offset: 0, Line: 2},
+		{Offset: 2, Line: 3},
+		{Offset: 4, Line: 2},
+	}
+	if fmt.Sprint(fn.Lines) != fmt.Sprint(expectedFn) {
+		t.Errorf("wrong function lines. want=%v, got=%v", expectedFn, fn.Lines)
+	}
+}
@@ -0,0 +1,123 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ioanzicu/monkeyd/code"
+	"github.com/ioanzicu/monkeyd/object"
+)
+
+// Disassemble - print the main instructions followed by every
+// compiled function of the constant pool, operands referring to
+// constants, globals, builtins and closures are annotated
+func Disassemble(w io.Writer, bc *Bytecode) error {
+	if bc.NumLocals > 0 {
+		fmt.Fprintf(w, "== main (NumLocals=%d) ==\n", bc.NumLocals)
+	} else {
+		fmt.Fprintf(w, "== main ==\n")
+	}
+	if err := disassembleInstructions(w, bc, bc.Instructions); err != nil {
+		return err
+	}
+
+	for i, c := range bc.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		name := ""
+		if fn.Name != "" {
+			name = " " + fn.Name
+		}
+
+		params := fmt.Sprintf("NumParameters=%d", fn.NumParameters)
+		if fn.NumDefaults > 0 {
+			params += fmt.Sprintf(" NumDefaults=%d", fn.NumDefaults)
+		}
+		if fn.Variadic {
+			params += " Variadic"
+		}
+
+		fmt.Fprintf(
+			w, "\n== constant %d: CompiledFunction%s (NumLocals=%d %s) ==\n",
+			i, name, fn.NumLocals, params,
+		)
+		if err := disassembleInstructions(w, bc, fn.Instructions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func disassembleInstructions(w io.Writer, bc *Bytecode, ins code.Instructions) error {
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return fmt.Errorf("offset %d: %s", ip, err)
+		}
+
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+
+		line := []string{def.Name}
+		for _, o := range operands {
+			line = append(line, strconv.Itoa(o))
+		}
+
+		text := strings.Join(line, " ")
+		if note := annotate(bc, code.Opcode(ins[ip]), operands); note != "" {
+			fmt.Fprintf(w, "%04d %-24s ; %s\n", ip, text, note)
+		} else {
+			fmt.Fprintf(w, "%04d %s\n", ip, text)
+		}
+
+		ip += 1 + read
+	}
+
+	return nil
+}
+
+// annotate - readable meaning of the instruction operands
+func annotate(bc *Bytecode, op code.Opcode, operands []int) string {
+	switch op {
+
+	case code.OpConstant:
+		if operands[0] < len(bc.Constants) {
+			return constantString(bc.Constants[operands[0]])
+		}
+
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if operands[0] < len(bc.Globals) && bc.Globals[operands[0]] != "" {
+			return bc.Globals[operands[0]]
+		}
+
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+
+	case code.OpClosure:
+		return fmt.Sprintf("constant %d, %d free", operands[0], operands[1])
+
+	}
+
+	return ""
+}
+
+func constantString(obj object.Object) string {
+	switch obj := obj.(type) {
+
+	case *object.String:
+		return strconv.Quote(obj.Value)
+
+	case *object.CompiledFunction:
+		return "CompiledFunction"
+
+	default:
+		return obj.Inspect()
+	}
+}
@@ -0,0 +1,50 @@
+package compiler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `
+	let name = "monkey";
+	let greet = fn(x) { let y = len(x); fn() { y + 1 } };
+	greet(name)();
+	`
+
+	expected := `== main ==
+0000 OpConstant 0             ; "monkey"
+0003 OpSetGlobal 0            ; name
+0006 OpClosure 3 0            ; constant 3, 0 free
+0010 OpSetGlobal 1            ; greet
+0013 OpGetGlobal 1            ; greet
+0016 OpGetGlobal 0            ; name
+0019 OpCall 1
+0021 OpCall 0
+0023 OpPop
+
+== constant 2: CompiledFunction (NumLocals=0 NumParameters=0) ==
+0000 OpGetFree 0
+0002 OpConstant 1             ; 1
+0005 OpAdd
+0006 OpReturnValue
+
+== constant 3: CompiledFunction greet (NumLocals=2 NumParameters=1) ==
+0000 OpGetBuiltin 0           ; len
+0002 OpGetLocal 0
+0004 OpCall 1
+0006 OpSetLocal 1
+0008 OpCaptureLocal 1
+0010 OpClosure 2 1            ; constant 2, 1 free
+0014 OpReturnValue
+`
+
+	var out bytes.Buffer
+	if err := Disassemble(&out, compileBytecode(t, input)); err != nil {
+		t.Fatalf("Disassemble error: %s", err)
+	}
+
+	if out.String() != expected {
+		t.Errorf("wrong disassembly.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,668 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/ioanzicu/monkeyd/code"
+	"github.com/ioanzicu/monkeyd/object"
+)
+
+// Serialized bytecode layout:
+//
+//	magic              4 bytes "MKDC"
+//	format version     uint16, big endian
+//	opcode set version uint16, big endian (code.Version)
+//	payload            uvarint encoded, see encodePayload
+//	checksum           uint32, big endian, CRC-32 (IEEE) of everything before it
+const (
+	bytecodeMagic = "MKDC"
+
+	// FormatVersion - version of the container layout,
+	// bump it whenever the encoding of the payload changes
+	FormatVersion = 8
+
+	headerSize   = len(bytecodeMagic) + 2 + 2
+	checksumSize = 4
+)
+
+// Constant tags of the serialized constant pool
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagCompiledFunction
+	tagFloat
+	tagBigInt
+)
+
+var (
+	// ErrCorruptBytecode - the file is not valid serialized bytecode
+	ErrCorruptBytecode = errors.New("corrupt bytecode")
+
+	// ErrIncompatibleBytecode - the file was produced by an
+	// incompatible version of the compiler
+	ErrIncompatibleBytecode = errors.New("incompatible bytecode")
+)
+
+// WriteBytecode - serialize the bytecode into w
+func WriteBytecode(w io.Writer, bc *Bytecode) error {
+	payload, err := encodePayload(bc)
+	if err != nil {
+		return err
+	}
+
+	out := make([]byte, 0, headerSize+len(payload)+checksumSize)
+	out = append(out, bytecodeMagic...)
+	out = binary.BigEndian.AppendUint16(out, FormatVersion)
+	out = binary.BigEndian.AppendUint16(out, code.Version)
+	out = append(out, payload...)
+	out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out))
+
+	_, err = w.Write(out)
+	return err
+}
+
+// ReadBytecode - load and validate bytecode written by WriteBytecode,
+// the returned error wraps ErrCorruptBytecode or ErrIncompatibleBytecode
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(bytecodeMagic) || string(data[:len(bytecodeMagic)]) != bytecodeMagic {
+		return nil, fmt.Errorf("%w: not a Monkey bytecode file", ErrCorruptBytecode)
+	}
+
+	if len(data) < headerSize+checksumSize {
+		return nil, fmt.Errorf("%w: file is truncated", ErrCorruptBytecode)
+	}
+
+	formatVersion := binary.BigEndian.Uint16(data[4:])
+	if formatVersion != FormatVersion {
+		return nil, fmt.Errorf(
+			"%w: format version %d, want %d",
+			ErrIncompatibleBytecode, formatVersion, FormatVersion,
+		)
+	}
+
+	opcodeVersion := binary.BigEndian.Uint16(data[6:])
+	if opcodeVersion != code.Version {
+		return nil, fmt.Errorf(
+			"%w: opcode set version %d, want %d",
+			ErrIncompatibleBytecode, opcodeVersion, code.Version,
+		)
+	}
+
+	body := data[:len(data)-checksumSize]
+	checksum := binary.BigEndian.Uint32(data[len(data)-checksumSize:])
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptBytecode)
+	}
+
+	bc, err := decodePayload(body[headerSize:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorruptBytecode, err)
+	}
+
+	if err := Validate(bc); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCorruptBytecode, err)
+	}
+
+	return bc, nil
+}
+
+// encodePayload - constant pool, main instructions with their
+// line table and locals, and global names
+func encodePayload(bc *Bytecode) ([]byte, error) {
+	var out []byte
+
+	out = binary.AppendUvarint(out, uint64(len(bc.Constants)))
+	for i, c := range bc.Constants {
+		switch c := c.(type) {
+
+		case *object.Integer:
+			out = append(out, tagInteger)
+			out = binary.AppendVarint(out, c.Value)
+
+		case *object.Float:
+			out = append(out, tagFloat)
+			out = binary.BigEndian.AppendUint64(out, math.Float64bits(c.Value))
+
+		case *object.BigInt:
+			out = append(out, tagBigInt, byte(c.Value.Sign()+1))
+			out = appendBytes(out, c.Value.Bytes())
+
+		case *object.String:
+			out = append(out, tagString)
+			out = appendBytes(out, []byte(c.Value))
+
+		case *object.CompiledFunction:
+			out = append(out, tagCompiledFunction)
+			out = binary.AppendUvarint(out, uint64(c.NumLocals))
+			out = binary.AppendUvarint(out, uint64(c.NumParameters))
+			out = binary.AppendUvarint(out, uint64(c.NumDefaults))
+			out = append(out, boolByte(c.Variadic))
+			out = appendBytes(out, []byte(c.Name))
+			out = appendStrings(out, c.ParameterNames)
+			out = appendBytes(out, c.Instructions)
+			out = appendLines(out, c.Lines)
+
+		default:
+			return nil, fmt.Errorf("cannot serialize constant %d of type %s", i, c.Type())
+		}
+	}
+
+	out = appendBytes(out, bc.Instructions)
+	out = appendLines(out, bc.Lines)
+	out = binary.AppendUvarint(out, uint64(bc.NumLocals))
+
+	out = appendStrings(out, bc.Globals)
+
+	return out, nil
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func appendBytes(out []byte, b []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+func appendStrings(out []byte, strs []string) []byte {
+	out = binary.AppendUvarint(out, uint64(len(strs)))
+	for _, s := range strs {
+		out = appendBytes(out, []byte(s))
+	}
+
+	return out
+}
+
+// appendLines - entries are delta encoded, offsets only grow
+func appendLines(out []byte, lines code.LineTable) []byte {
+	out = binary.AppendUvarint(out, uint64(len(lines)))
+
+	offset, line := 0, 0
+	for _, e := range lines {
+		out = binary.AppendUvarint(out, uint64(e.Offset-offset))
+		out = binary.AppendVarint(out, int64(e.Line-line))
+		offset, line = e.Offset, e.Line
+	}
+
+	return out
+}
+
+func decodePayload(data []byte) (*Bytecode, error) {
+	d := &decoder{data: data}
+
+	numConstants := d.length()
+	constants := []object.Object{}
+
+	for i := 0; i < numConstants && d.err == nil; i++ {
+		tag := d.byte()
+
+		switch tag {
+
+		case tagInteger:
+			constants = append(constants, &object.Integer{Value: d.varint()})
+
+		case tagFloat:
+			constants = append(constants, &object.Float{Value: math.Float64frombits(d.uint64())})
+
+		case tagBigInt:
+			constants = append(constants, d.bigInt())
+
+		case tagString:
+			constants = append(constants, &object.String{Value: string(d.bytes())})
+
+		case tagCompiledFunction:
+			fn := &object.CompiledFunction{
+				NumLocals:     d.length(),
+				NumParameters: d.length(),
+				NumDefaults:   d.length(),
+				Variadic:      d.byte() != 0,
+			}
+			fn.Name = string(d.bytes())
+			fn.ParameterNames = d.strings()
+			fn.Instructions = d.bytes()
+			fn.Lines = d.lines()
+			constants = append(constants, fn)
+
+		default:
+			if d.err == nil {
+				return nil, fmt.Errorf("constant %d has unknown tag %d", i, tag)
+			}
+		}
+	}
+
+	instructions := d.bytes()
+	lines := d.lines()
+	numLocals := d.length()
+
+	globals := d.strings()
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("%d unexpected trailing bytes", len(d.data)-d.off)
+	}
+
+	return &Bytecode{
+		Instructions: instructions,
+		Constants:    constants,
+		Globals:      globals,
+		Lines:        lines,
+		NumLocals:    numLocals,
+	}, nil
+}
+
+// decoder - reads the payload, the first failure sticks in err
+// and every later read returns a zero value
+type decoder struct {
+	data []byte
+	off  int
+	err  error
+}
+
+var errUnexpectedEnd = errors.New("unexpected end of data")
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	if d.off >= len(d.data) {
+		d.err = errUnexpectedEnd
+		return 0
+	}
+
+	b := d.data[d.off]
+	d.off++
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data[d.off:])
+	if n <= 0 {
+		d.err = errUnexpectedEnd
+		return 0
+	}
+
+	d.off += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data[d.off:])
+	if n <= 0 {
+		d.err = errUnexpectedEnd
+		return 0
+	}
+
+	d.off += n
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	if len(d.data)-d.off < 8 {
+		d.err = errUnexpectedEnd
+		return 0
+	}
+
+	v := binary.BigEndian.Uint64(d.data[d.off:])
+	d.off += 8
+	return v
+}
+
+// bigInt - a sign byte, 0 for negative and 2 for positive,
+// followed by the magnitude
+func (d *decoder) bigInt() object.Object {
+	sign := d.byte()
+	value := new(big.Int).SetBytes(d.bytes())
+
+	if sign == 0 {
+		value.Neg(value)
+	}
+
+	return object.IntegerFromBig(value)
+}
+
+// length - a count or size, bounded by the remaining data
+// so corrupted input can not trigger huge allocations
+func (d *decoder) length() int {
+	v := d.uvarint()
+	if v > uint64(len(d.data)-d.off) {
+		if d.err == nil {
+			d.err = errUnexpectedEnd
+		}
+		return 0
+	}
+
+	return int(v)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	if d.err != nil {
+		return nil
+	}
+
+	b := bytes.Clone(d.data[d.off : d.off+n])
+	d.off += n
+	return b
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+
+	strs := []string{}
+	for i := 0; i < n && d.err == nil; i++ {
+		strs = append(strs, string(d.bytes()))
+	}
+
+	return strs
+}
+
+func (d *decoder) lines() code.LineTable {
+	n := d.length()
+
+	var lines code.LineTable
+	offset, line := 0, 0
+	for i := 0; i < n && d.err == nil; i++ {
+		offset += int(d.uvarint())
+		line += int(d.varint())
+		lines = append(lines, code.LineEntry{Offset: offset, Line: line})
+	}
+
+	return lines
+}
+
+// Validate - check that every instruction of the bytecode is
+// well formed and its operands are in range, so the VM can run it
+func Validate(bc *Bytecode) error {
+	v := &validator{
+		constants: bc.Constants,
+		numFree:   map[int]int{},
+		maxFree:   map[int]int{},
+	}
+
+	if err := v.validate(bc.Instructions, bc.NumLocals, -1); err != nil {
+		return fmt.Errorf("main: %s", err)
+	}
+
+	for i, c := range bc.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		numParameters := fn.NumParameters
+		if fn.Variadic {
+			numParameters++
+		}
+
+		if numParameters > fn.NumLocals {
+			return fmt.Errorf("constant %d: %d parameters exceed %d locals", i, numParameters, fn.NumLocals)
+		}
+
+		if fn.NumDefaults > fn.NumParameters {
+			return fmt.Errorf("constant %d: %d defaults exceed %d parameters", i, fn.NumDefaults, fn.NumParameters)
+		}
+
+		if len(fn.ParameterNames) != fn.NumParameters {
+			return fmt.Errorf("constant %d: %d parameter names for %d parameters", i, len(fn.ParameterNames), fn.NumParameters)
+		}
+
+		if err := v.validate(fn.Instructions, fn.NumLocals, i); err != nil {
+			return fmt.Errorf("constant %d: %s", i, err)
+		}
+	}
+
+	// functions are closed over after their own body is validated,
+	// so the free variables can only be checked at the end
+	for fnIndex, max := range v.maxFree {
+		if n, ok := v.numFree[fnIndex]; ok && max >= n {
+			return fmt.Errorf("constant %d: free variable index %d out of range", fnIndex, max)
+		}
+	}
+
+	return nil
+}
+
+type validator struct {
+	constants []object.Object
+
+	numFree map[int]int // function constant -> free variables it is closed over with
+	maxFree map[int]int // function constant -> highest free variable index it reads
+}
+
+// validate - fnIndex is -1 for the main program
+func (v *validator) validate(ins code.Instructions, numLocals int, fnIndex int) error {
+	starts := map[int]bool{}
+	jumps := map[int]int{} // instruction offset -> target
+
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return fmt.Errorf("offset %d: %s", ip, err)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+
+		if ip+1+width > len(ins) {
+			return fmt.Errorf("offset %d: %s operands are truncated", ip, def.Name)
+		}
+
+		starts[ip] = true
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+
+		switch code.Opcode(ins[ip]) {
+
+		case code.OpConstant:
+			if operands[0] >= len(v.constants) {
+				return fmt.Errorf("offset %d: constant index %d out of range", ip, operands[0])
+			}
+
+		case code.OpClosure:
+			if operands[0] >= len(v.constants) {
+				return fmt.Errorf("offset %d: constant index %d out of range", ip, operands[0])
+			}
+
+			if _, ok := v.constants[operands[0]].(*object.CompiledFunction); !ok {
+				return fmt.Errorf("offset %d: constant %d is not a function", ip, operands[0])
+			}
+
+			if n, ok := v.numFree[operands[0]]; ok && n != operands[1] {
+				return fmt.Errorf(
+					"offset %d: function %d closed over %d and %d free variables",
+					ip, operands[0], n, operands[1],
+				)
+			}
+			v.numFree[operands[0]] = operands[1]
+
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpTruthy, code.OpIterNext:
+			jumps[ip] = operands[0]
+
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return fmt.Errorf("offset %d: builtin index %d out of range", ip, operands[0])
+			}
+
+		case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal, code.OpClearLocal:
+			if operands[0] >= numLocals {
+				return fmt.Errorf("offset %d: local index %d out of range", ip, operands[0])
+			}
+
+		case code.OpGetFree, code.OpSetFree, code.OpCaptureFree:
+			if fnIndex < 0 {
+				return fmt.Errorf("offset %d: %s outside of a function", ip, def.Name)
+			}
+
+			if max, ok := v.maxFree[fnIndex]; !ok || operands[0] > max {
+				v.maxFree[fnIndex] = operands[0]
+			}
+
+		case code.OpCurrentClosure:
+			if fnIndex < 0 {
+				return fmt.Errorf("offset %d: %s outside of a function", ip, def.Name)
+			}
+
+		case code.OpDefault:
+			if fnIndex < 0 {
+				return fmt.Errorf("offset %d: %s outside of a function", ip, def.Name)
+			}
+
+			if operands[0] >= numLocals {
+				return fmt.Errorf("offset %d: local index %d out of range", ip, operands[0])
+			}
+			jumps[ip] = operands[1]
+
+		}
+
+		ip += 1 + read
+	}
+
+	for ip, target := range jumps {
+		if target != len(ins) && !starts[target] {
+			return fmt.Errorf("offset %d: jump target %d is not an instruction", ip, target)
+		}
+	}
+
+	return checkStack(ins)
+}
+
+// checkStack - follow every path through the instructions keeping
+// the lowest stack height each one is reached with, no instruction
+// may pop more values than its frame has pushed
+func checkStack(ins code.Instructions) error {
+	if len(ins) == 0 {
+		return nil
+	}
+
+	heights := map[int]int{0: 0} // instruction offset -> lowest height on entry
+	work := []int{0}
+
+	reach := func(ip, height int) {
+		if ip >= len(ins) {
+			return
+		}
+
+		if lowest, ok := heights[ip]; !ok || height < lowest {
+			heights[ip] = height
+			work = append(work, ip)
+		}
+	}
+
+	for len(work) > 0 {
+		ip := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		op := code.Opcode(ins[ip])
+		def, _ := code.Lookup(ins[ip])
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+
+		height := heights[ip]
+		pops, pushes := stackEffect(op, operands)
+		if height < pops {
+			return fmt.Errorf("offset %d: stack underflow, %s pops %d with %d on the stack", ip, def.Name, pops, height)
+		}
+		height += pushes - pops
+
+		next := ip + 1 + read
+
+		switch op {
+		case code.OpJump:
+			reach(operands[0], height)
+		case code.OpJumpNotTruthy, code.OpJumpTruthy:
+			reach(operands[0], height)
+			reach(next, height)
+		case code.OpDefault:
+			reach(operands[1], height)
+			reach(next, height)
+		case code.OpIterNext:
+			// an exhausted iterator jumps without pushing an element
+			reach(operands[0], height-1)
+			reach(next, height)
+		case code.OpReturnValue, code.OpReturn:
+		default:
+			reach(next, height)
+		}
+	}
+
+	return nil
+}
+
+// stackEffect - how many values the instruction pops and pushes
+func stackEffect(op code.Opcode, operands []int) (pops, pushes int) {
+	switch op {
+	case code.OpPop, code.OpJumpNotTruthy, code.OpJumpTruthy, code.OpReturnValue,
+		code.OpSetGlobal, code.OpSetLocal, code.OpSetFree:
+		return 1, 0
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual,
+		code.OpLessThan, code.OpLessThanOrEqual, code.OpIndex:
+		return 2, 1
+
+	case code.OpMinus, code.OpBang, code.OpBitNot, code.OpIter, code.OpRest, code.OpIterNext:
+		return 1, 1
+
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree,
+		code.OpCaptureLocal, code.OpCaptureFree, code.OpCurrentClosure:
+		return 0, 1
+
+	case code.OpArray, code.OpHash, code.OpConcat:
+		return operands[0], 1
+
+	case code.OpClosure:
+		return operands[1], 1
+
+	case code.OpCall, code.OpCallSpread:
+		// the callee sits below the arguments
+		return operands[0] + 1, 1
+
+	case code.OpCallNamed:
+		// a name and a value for each named argument
+		return operands[0] + 2*operands[1] + 1, 1
+
+	case code.OpIndexKeep:
+		return 2, 3
+
+	case code.OpSetIndex:
+		return 3, 1
+
+	default:
+		// OpJump, OpReturn, OpClearLocal and OpDefault
+		return 0, 0
+	}
+}
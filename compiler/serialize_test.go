@@ -0,0 +1,341 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/ioanzicu/monkeyd/code"
+	"github.com/ioanzicu/monkeyd/object"
+)
+
+func compileBytecode(t *testing.T, input string) *Bytecode {
+	t.Helper()
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return compiler.Bytecode()
+}
+
+func writeBytecode(t *testing.T, bc *Bytecode) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteBytecode(&buf, bc); err != nil {
+		t.Fatalf("WriteBytecode error: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+	let greeting = "hello";
+	let newAdder = fn(a) { fn(b) { a + b } };
+	let countDown = fn(x) { if (x > 0) { countDown(x - 1) } else { -1 } };
+	puts(greeting, newAdder(2)(3), countDown(3), [1, 2][0], {"k": 99}["k"], 3.14, -1e-300, 99999999999999999999);
+	for (c in greeting) { puts(c); }
+	let join = fn(sep = ", ", ...parts) { parts };
+	join(...["a", "b"]);
+	join(sep: "-");
+	`
+
+	bc := compileBytecode(t, input)
+
+	loaded, err := ReadBytecode(bytes.NewReader(writeBytecode(t, bc)))
+	if err != nil {
+		t.Fatalf("ReadBytecode error: %s", err)
+	}
+
+	if !bytes.Equal(loaded.Instructions, bc.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\ngot=%q", bc.Instructions, loaded.Instructions)
+	}
+
+	if fmt.Sprint(loaded.Lines) != fmt.Sprint(bc.Lines) {
+		t.Errorf("wrong lines. want=%v, got=%v", bc.Lines, loaded.Lines)
+	}
+
+	if strings.Join(loaded.Globals, ",") != strings.Join(bc.Globals, ",") {
+		t.Errorf("wrong globals. want=%q, got=%q", bc.Globals, loaded.Globals)
+	}
+
+	if loaded.NumLocals != bc.NumLocals {
+		t.Errorf("wrong main locals. want=%d, got=%d", bc.NumLocals, loaded.NumLocals)
+	}
+
+	if len(loaded.Constants) != len(bc.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bc.Constants), len(loaded.Constants))
+	}
+
+	for i, want := range bc.Constants {
+		got := loaded.Constants[i]
+
+		switch want := want.(type) {
+
+		case *object.CompiledFunction:
+			fn, ok := got.(*object.CompiledFunction)
+			if !ok {
+				t.Fatalf("constant %d - not a function. got=%T", i, got)
+			}
+
+			if fn.NumLocals != want.NumLocals || fn.NumParameters != want.NumParameters {
+				t.Errorf("constant %d - wrong locals/parameters. want=%d/%d, got=%d/%d",
+					i, want.NumLocals, want.NumParameters, fn.NumLocals, fn.NumParameters)
+			}
+
+			if fn.NumDefaults != want.NumDefaults || fn.Variadic != want.Variadic {
+				t.Errorf("constant %d - wrong defaults/variadic. want=%d/%t, got=%d/%t",
+					i, want.NumDefaults, want.Variadic, fn.NumDefaults, fn.Variadic)
+			}
+
+			if !bytes.Equal(fn.Instructions, want.Instructions) {
+				t.Errorf("constant %d - wrong instructions.\nwant=%q\ngot=%q", i, want.Instructions, fn.Instructions)
+			}
+
+			if strings.Join(fn.ParameterNames, ",") != strings.Join(want.ParameterNames, ",") {
+				t.Errorf("constant %d - wrong parameter names. want=%q, got=%q", i, want.ParameterNames, fn.ParameterNames)
+			}
+
+			if fn.Name != want.Name || fmt.Sprint(fn.Lines) != fmt.Sprint(want.Lines) {
+				t.Errorf("constant %d - wrong name or lines. want=%q %v, got=%q %v",
+					i, want.Name, want.Lines, fn.Name, fn.Lines)
+			}
+
+		default:
+			if got.Type() != want.Type() || got.Inspect() != want.Inspect() {
+				t.Errorf("constant %d - want=%s %s, got=%s %s", i, want.Type(), want.Inspect(), got.Type(), got.Inspect())
+			}
+		}
+	}
+}
+
+// withChecksum - recompute the checksum of a tampered file
+func withChecksum(data []byte) []byte {
+	body := data[:len(data)-checksumSize]
+	return binary.BigEndian.AppendUint32(bytes.Clone(body), crc32.ChecksumIEEE(body))
+}
+
+func TestReadBytecodeErrors(t *testing.T) {
+	valid := writeBytecode(t, compileBytecode(t, `let f = fn(x) { x * 2 }; f(21);`))
+
+	badOpcodeVersion := bytes.Clone(valid)
+	binary.BigEndian.PutUint16(badOpcodeVersion[6:], code.Version+1)
+
+	badFormatVersion := bytes.Clone(valid)
+	binary.BigEndian.PutUint16(badFormatVersion[4:], FormatVersion+1)
+
+	flipped := bytes.Clone(valid)
+	flipped[len(flipped)-checksumSize-1] ^= 0xff
+
+	tests := []struct {
+		name        string
+		data        []byte
+		expectedErr error
+		expectedMsg string
+	}{
+		{"empty", []byte{}, ErrCorruptBytecode, "not a Monkey bytecode file"},
+		{"bad magic", []byte("#!/usr/bin/env monkeyd"), ErrCorruptBytecode, "not a Monkey bytecode file"},
+		{"truncated header", valid[:6], ErrCorruptBytecode, "file is truncated"},
+		{"format version", badFormatVersion, ErrIncompatibleBytecode, "format version"},
+		{"opcode version", badOpcodeVersion, ErrIncompatibleBytecode, "opcode set version"},
+		{"flipped byte", flipped, ErrCorruptBytecode, "checksum mismatch"},
+		{"truncated payload", withChecksum(valid[:len(valid)-10]), ErrCorruptBytecode, "unexpected end of data"},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadBytecode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+			continue
+		}
+
+		if !errors.Is(err, tt.expectedErr) {
+			t.Errorf("%s: error does not wrap %q. got=%q", tt.name, tt.expectedErr, err)
+		}
+
+		if !strings.Contains(err.Error(), tt.expectedMsg) {
+			t.Errorf("%s: wrong error message. want to contain %q, got=%q", tt.name, tt.expectedMsg, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fn := &object.CompiledFunction{
+		Instructions: concatInstructions([]code.Instructions{
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpGetFree, 1),
+			code.Make(code.OpAdd),
+			code.Make(code.OpReturnValue),
+		}),
+		NumLocals:      1,
+		NumParameters:  1,
+		ParameterNames: []string{"a"},
+	}
+
+	tests := []struct {
+		name         string
+		instructions []code.Instructions
+		constants    []object.Object
+		expectedErr  string
+	}{
+		{
+			name:         "undefined opcode",
+			instructions: []code.Instructions{{255}},
+			expectedErr:  "main: offset 0: opcode 255 undefined",
+		},
+		{
+			name:         "truncated operands",
+			instructions: []code.Instructions{code.Make(code.OpConstant, 0)[:2]},
+			constants:    []object.Object{&object.Integer{Value: 1}},
+			expectedErr:  "main: offset 0: OpConstant operands are truncated",
+		},
+		{
+			name:         "constant out of range",
+			instructions: []code.Instructions{code.Make(code.OpConstant, 1)},
+			constants:    []object.Object{&object.Integer{Value: 1}},
+			expectedErr:  "main: offset 0: constant index 1 out of range",
+		},
+		{
+			name:         "closure over non function",
+			instructions: []code.Instructions{code.Make(code.OpClosure, 0, 0)},
+			constants:    []object.Object{&object.Integer{Value: 1}},
+			expectedErr:  "main: offset 0: constant 0 is not a function",
+		},
+		{
+			name: "jump into operands",
+			instructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 1),
+			},
+			constants:   []object.Object{&object.Integer{Value: 1}},
+			expectedErr: "main: offset 3: jump target 1 is not an instruction",
+		},
+		{
+			name:         "builtin out of range",
+			instructions: []code.Instructions{code.Make(code.OpGetBuiltin, 200)},
+			expectedErr:  "main: offset 0: builtin index 200 out of range",
+		},
+		{
+			name:         "local beyond the main locals",
+			instructions: []code.Instructions{code.Make(code.OpGetLocal, 0)},
+			expectedErr:  "main: offset 0: local index 0 out of range",
+		},
+		{
+			name:         "default outside of a function",
+			instructions: []code.Instructions{code.Make(code.OpDefault, 0, 4)},
+			expectedErr:  "main: offset 0: OpDefault outside of a function",
+		},
+		{
+			name: "free variable out of range",
+			instructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpClosure, 0, 1),
+			},
+			constants:   []object.Object{fn, &object.Integer{Value: 1}},
+			expectedErr: "constant 0: free variable index 1 out of range",
+		},
+		{
+			name:         "operator on an empty stack",
+			instructions: []code.Instructions{code.Make(code.OpAdd)},
+			expectedErr:  "main: offset 0: stack underflow, OpAdd pops 2 with 0 on the stack",
+		},
+		{
+			name:         "call without a callee",
+			instructions: []code.Instructions{code.Make(code.OpCall, 5)},
+			expectedErr:  "main: offset 0: stack underflow, OpCall pops 6 with 0 on the stack",
+		},
+		{
+			name: "named call without a value",
+			instructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCallNamed, 0, 1),
+			},
+			constants:   []object.Object{fn, &object.String{Value: "a"}},
+			expectedErr: "main: offset 7: stack underflow, OpCallNamed pops 3 with 2 on the stack",
+		},
+		{
+			name:         "parameters without names",
+			instructions: []code.Instructions{code.Make(code.OpNull)},
+			constants: []object.Object{&object.CompiledFunction{
+				Instructions:  concatInstructions([]code.Instructions{code.Make(code.OpReturn)}),
+				NumLocals:     1,
+				NumParameters: 1,
+			}},
+			expectedErr: "constant 0: 0 parameter names for 1 parameters",
+		},
+		{
+			name: "underflow on a jump path",
+			instructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 5),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+			expectedErr: "main: offset 5: stack underflow, OpPop pops 1 with 0 on the stack",
+		},
+		{
+			name: "function popping below its frame",
+			instructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+			constants: []object.Object{fn, &object.CompiledFunction{
+				Instructions: concatInstructions([]code.Instructions{code.Make(code.OpReturnValue)}),
+			}},
+			expectedErr: "constant 1: offset 0: stack underflow, OpReturnValue pops 1 with 0 on the stack",
+		},
+		{
+			name:         "return from the main program without a value",
+			instructions: []code.Instructions{code.Make(code.OpReturnValue)},
+			expectedErr:  "main: offset 0: stack underflow, OpReturnValue pops 1 with 0 on the stack",
+		},
+		{
+			// the VM ends the run, it does not pop the main frame
+			name: "return from the main program",
+			instructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpReturnValue),
+				code.Make(code.OpReturn),
+			},
+			constants: []object.Object{&object.Integer{Value: 1}},
+		},
+		{
+			name: "valid closure",
+			instructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpClosure, 0, 2),
+				code.Make(code.OpPop),
+			},
+			constants: []object.Object{fn, &object.Integer{Value: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		bc := &Bytecode{
+			Instructions: concatInstructions(tt.instructions),
+			Constants:    tt.constants,
+		}
+
+		err := Validate(bc)
+
+		if tt.expectedErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != tt.expectedErr {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expectedErr, err)
+		}
+	}
+}
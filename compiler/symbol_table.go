@@ -8,12 +8,14 @@ const (
 	BuiltinScope  SymbolScope = "BUILTIN"
 	FreeScope     SymbolScope = "FREE"
 	FunctionScope SymbolScope = "FUNCTION"
+	ConstantScope SymbolScope = "CONSTANT" // a const inlined from the constant pool
 )
 
 type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	Const bool // bound by `const`, it can not be assigned
 }
 
 type SymbolTable struct {
@@ -23,6 +25,12 @@ type SymbolTable struct {
 	numDefinitions int
 
 	FreeSymbols []Symbol
+
+	// a block shares the local slots of the enclosing function,
+	// or of the main program, its names are gone once it ends
+	block bool
+
+	numSlots int // local slots used by the function and its blocks
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -41,9 +49,40 @@ func (s *SymbolTable) Define(name string) Symbol {
 
 	s.store[name] = symbol
 	s.numDefinitions++
+
+	if symbol.Scope == LocalScope {
+		frame := s.frame()
+		frame.numSlots = max(frame.numSlots, s.numDefinitions)
+	}
+
+	return symbol
+}
+
+// DefineConst - like Define, for a binding that can not be
+// assigned or defined again in the same scope
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+
+	s.store[name] = symbol
 	return symbol
 }
 
+// DefineInlined - a const whose value is known at compile time, its
+// uses load the constant at constIndex and it takes no slot
+func (s *SymbolTable) DefineInlined(name string, constIndex int) Symbol {
+	symbol := Symbol{Name: name, Index: constIndex, Scope: ConstantScope, Const: true}
+	s.store[name] = symbol
+	return symbol
+}
+
+// definesConst - whether name is bound by `const` in this scope
+// itself, an outer one can be shadowed
+func (s *SymbolTable) definesConst(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Const
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = symbol
@@ -57,15 +96,31 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 }
 
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// ResolveAssignable - like Resolve, but the name of a function in its
+// own body is the variable the function is bound to rather than the
+// running closure, and it stays that variable for the rest of the body
+func (s *SymbolTable) ResolveAssignable(name string) (Symbol, bool) {
+	return s.resolve(name, true)
+}
+
+func (s *SymbolTable) resolve(name string, assignable bool) (Symbol, bool) {
 	obj, ok := s.store[name]
+	if ok && assignable && obj.Scope == FunctionScope {
+		delete(s.store, name)
+		ok = false
+	}
+
 	if !ok && s.Outer != nil {
 		// Recursively check in the parent scope
-		obj, ok = s.Outer.Resolve(name)
+		obj, ok = s.Outer.resolve(name, assignable)
 		if !ok {
 			return obj, ok
 		}
 
-		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope || obj.Scope == ConstantScope || s.block {
 			return obj, ok
 		}
 
@@ -81,6 +136,30 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// NewBlockSymbolTable - scope of a block, its locals take the slots
+// after the ones of the enclosing scope, in the main program they
+// are locals of the main frame and start at 0
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+
+	if outer.block || outer.Outer != nil {
+		s.numDefinitions = outer.numDefinitions
+	}
+
+	return s
+}
+
+// frame - the table of the function, or the main program,
+// whose frame holds the locals defined in s
+func (s *SymbolTable) frame() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+
+	return s
+}
+
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
 
@@ -90,3 +169,31 @@ func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.store[original.Name] = symbol
 	return symbol
 }
+
+// origin - the symbol a free symbol was captured from,
+// followed out through every enclosing function
+func (s *SymbolTable) origin(symbol Symbol) Symbol {
+	for table := s.frame(); symbol.Scope == FreeScope; table = table.Outer.frame() {
+		symbol = table.FreeSymbols[symbol.Index]
+	}
+
+	return symbol
+}
+
+// globalNames - names of the global symbols, indexed by symbol index
+func (s *SymbolTable) globalNames() []string {
+	names := []string{}
+
+	for _, symbol := range s.store {
+		if symbol.Scope != GlobalScope {
+			continue
+		}
+
+		for len(names) <= symbol.Index {
+			names = append(names, "")
+		}
+		names[symbol.Index] = symbol.Name
+	}
+
+	return names
+}
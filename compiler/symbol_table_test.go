@@ -154,6 +154,95 @@ func TestResolveNestedLocal(t *testing.T) {
 	}
 }
 
+func TestBlockScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	mainBlock := NewBlockSymbolTable(global)
+	mainBlock.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("c")
+
+	firstBlock := NewBlockSymbolTable(local)
+	firstBlock.Define("d")
+
+	nestedBlock := NewBlockSymbolTable(firstBlock)
+	nestedBlock.Define("e")
+
+	secondBlock := NewBlockSymbolTable(local)
+	secondBlock.Define("f")
+
+	tests := []struct {
+		table           *SymbolTable
+		expectedSymbols []Symbol
+	}{
+		{
+			mainBlock,
+			[]Symbol{
+				Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+				Symbol{Name: "b", Scope: LocalScope, Index: 0},
+			},
+		},
+		{
+			nestedBlock,
+			[]Symbol{
+				Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+				Symbol{Name: "c", Scope: LocalScope, Index: 0},
+				Symbol{Name: "d", Scope: LocalScope, Index: 1},
+				Symbol{Name: "e", Scope: LocalScope, Index: 2},
+			},
+		},
+		{
+			secondBlock,
+			[]Symbol{
+				Symbol{Name: "c", Scope: LocalScope, Index: 0},
+				Symbol{Name: "f", Scope: LocalScope, Index: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, sym := range tt.expectedSymbols {
+			result, ok := tt.table.Resolve(sym.Name)
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+
+	if _, ok := secondBlock.Resolve("d"); ok {
+		t.Errorf("name d resolvable outside of its block")
+	}
+
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("blocks defined free symbols. got=%+v", local.FreeSymbols)
+	}
+
+	if local.numSlots != 3 {
+		t.Errorf("wrong number of local slots. want=3, got=%d", local.numSlots)
+	}
+
+	if global.numSlots != 1 {
+		t.Errorf("wrong number of main program slots. want=1, got=%d", global.numSlots)
+	}
+
+	inner := NewEnclosedSymbolTable(nestedBlock)
+	expected := Symbol{Name: "d", Scope: FreeScope, Index: 0}
+	if result, ok := inner.Resolve("d"); !ok || result != expected {
+		t.Errorf("expected d to resolve to %+v, got=%+v", expected, result)
+	}
+
+	if origin := inner.origin(expected); origin.Scope != LocalScope || origin.Index != 1 {
+		t.Errorf("wrong origin of d. got=%+v", origin)
+	}
+}
+
 func TestDefineResolveBuiltins(t *testing.T) {
 	global := NewSymbolTable()
 	firstLocal := NewEnclosedSymbolTable(global)
@@ -332,3 +421,39 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("expected %s to resolve to %+v, got %+v", expected.Name, expected, result)
 	}
 }
+
+func TestDefineConst(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineConst("a")
+	global.DefineInlined("b", 3)
+	global.Define("c")
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineConst("d")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0, Const: true},
+		{Name: "b", Scope: ConstantScope, Index: 3, Const: true},
+		{Name: "c", Scope: GlobalScope, Index: 1},
+	}
+
+	for _, sym := range expected {
+		result, ok := local.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got %+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("inlined constant defined as a free symbol. got=%+v", local.FreeSymbols)
+	}
+
+	if !local.definesConst("d") || local.definesConst("a") || global.definesConst("c") {
+		t.Errorf("definesConst does not only report constants of its own table")
+	}
+}
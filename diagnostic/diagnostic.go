@@ -0,0 +1,145 @@
+// Diagnostics reported by the lexer, parser, compiler and VM
+package diagnostic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ioanzicu/monkeyd/ast"
+	"github.com/ioanzicu/monkeyd/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Code - stable identifier of a diagnostic kind,
+// the letter names the reporting phase
+type Code string
+
+const (
+	// Lexer
+	IllegalCharacter    Code = "L001"
+	UnterminatedString  Code = "L002"
+	UnterminatedComment Code = "L003"
+	InvalidEscape       Code = "L004"
+	InvalidNumber       Code = "L005"
+
+	// Parser
+	UnexpectedToken      Code = "P001"
+	MissingExpression    Code = "P002"
+	InvalidInteger       Code = "P003"
+	InvalidFloat         Code = "P004"
+	InvalidAssignment    Code = "P005"
+	MisplacedLoopControl Code = "P006"
+	InvalidParameter     Code = "P007"
+	InvalidArgument      Code = "P008"
+
+	// Compiler
+	UndefinedVariable Code = "C001"
+	UnknownOperator   Code = "C002"
+	ImmutableBinding  Code = "C003"
+
+	// Virtual Machine
+	RuntimeFailure Code = "R001"
+)
+
+// Span - the source range a diagnostic points at,
+// End is the position immediately after the range
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+func SpanOf(node ast.Node) Span {
+	return Span{Start: node.Pos(), End: node.End()}
+}
+
+func TokenSpan(tok token.Token) Span {
+	return Span{Start: tok.Pos, End: tok.End}
+}
+
+// Related - additional location that helps to explain a diagnostic
+type Related struct {
+	Message string
+	Span    Span
+}
+
+// Fix - suggested edit replacing the text in Span with Replacement
+type Fix struct {
+	Message     string
+	Span        Span
+	Replacement string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Span     Span
+	Related  []Related
+	Fix      *Fix
+}
+
+// Errorf - new error diagnostic with a formatted message
+func Errorf(code Code, span Span, format string, a ...any) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     span,
+	}
+}
+
+// Error - implements the error interface, so a diagnostic
+// can travel through APIs returning a plain error
+func (d *Diagnostic) Error() string {
+	if d.Span.Start.IsValid() {
+		return d.Span.Start.String() + ": " + d.Message
+	}
+	return d.Message
+}
+
+// List - diagnostics in the order they were reported
+type List []*Diagnostic
+
+func (l List) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Err - nil for an empty list, the list itself otherwise
+func (l List) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
@@ -0,0 +1,144 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ioanzicu/monkeyd/token"
+)
+
+func TestDiagnosticError(t *testing.T) {
+	tests := []struct {
+		diagnostic *Diagnostic
+		expected   string
+	}{
+		{
+			Errorf(RuntimeFailure, Span{}, "stack overflow"),
+			"stack overflow",
+		},
+		{
+			Errorf(UndefinedVariable, Span{Start: token.Position{Line: 2, Column: 5}}, "undefined variable %s", "x"),
+			"2:5: undefined variable x",
+		},
+		{
+			Errorf(UndefinedVariable, Span{Start: token.Position{Filename: "main.mk", Line: 1, Column: 1}}, "undefined variable %s", "y"),
+			"main.mk:1:1: undefined variable y",
+		},
+		{
+			Errorf(RuntimeFailure, Span{Start: token.Position{Filename: "main.mk", Line: 3}}, "division by zero"),
+			"main.mk:3: division by zero",
+		},
+		{
+			Errorf(RuntimeFailure, Span{Start: token.Position{Line: 3}}, "division by zero"),
+			"line 3: division by zero",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.diagnostic.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, tt.diagnostic.Error())
+		}
+	}
+}
+
+func TestFprint(t *testing.T) {
+	source := "let a = 1;\nlet b = a +\tfoo;\n"
+
+	d := Errorf(
+		UndefinedVariable,
+		Span{
+			Start: token.Position{Filename: "main.mk", Offset: 23, Line: 2, Column: 13},
+			End:   token.Position{Filename: "main.mk", Offset: 26, Line: 2, Column: 16},
+		},
+		"undefined variable %s", "foo",
+	)
+	d.Related = []Related{
+		{
+			Message: "did you mean `a`?",
+			Span: Span{
+				Start: token.Position{Filename: "main.mk", Offset: 4, Line: 1, Column: 5},
+				End:   token.Position{Filename: "main.mk", Offset: 5, Line: 1, Column: 6},
+			},
+		},
+	}
+	d.Fix = &Fix{Message: "replace with `a`", Span: d.Span, Replacement: "a"}
+
+	expected := "error[C001]: undefined variable foo\n" +
+		" --> main.mk:2:13\n" +
+		"  |\n" +
+		"2 | let b = a +\tfoo;\n" +
+		"  |            \t^^^\n" +
+		"note: did you mean `a`?\n" +
+		" --> main.mk:1:5\n" +
+		"  |\n" +
+		"1 | let a = 1;\n" +
+		"  |     ^\n" +
+		"help: replace with `a`\n"
+
+	var out bytes.Buffer
+	Fprint(&out, source, d)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestFprintUnicode(t *testing.T) {
+	source := "let naïve = \"日本\" + foo;\n"
+
+	d := Errorf(
+		UndefinedVariable,
+		Span{
+			Start: token.Position{Offset: 23, Line: 1, Column: 20},
+			End:   token.Position{Offset: 26, Line: 1, Column: 23},
+		},
+		"undefined variable %s", "foo",
+	)
+
+	expected := "error[C001]: undefined variable foo\n" +
+		" --> 1:20\n" +
+		"  |\n" +
+		"1 | let naïve = \"日本\" + foo;\n" +
+		"  |                    ^^^\n"
+
+	var out bytes.Buffer
+	Fprint(&out, source, d)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestFprintWithoutColumn(t *testing.T) {
+	source := "let a = 1;\nlet b = a / 0;\n"
+
+	d := Errorf(RuntimeFailure, Span{Start: token.Position{Filename: "main.mk", Line: 2}}, "division by zero")
+
+	expected := "error[R001]: division by zero\n" +
+		" --> main.mk:2\n" +
+		"  |\n" +
+		"2 | let b = a / 0;\n"
+
+	var out bytes.Buffer
+	Fprint(&out, source, d)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=%q\ngot =%q", expected, out.String())
+	}
+}
+
+func TestListErr(t *testing.T) {
+	var list List
+	if list.Err() != nil {
+		t.Errorf("empty list must not be an error")
+	}
+
+	list = append(list, Errorf(RuntimeFailure, Span{}, "one"), Errorf(RuntimeFailure, Span{}, "two"))
+	if list.Err() == nil {
+		t.Fatalf("non-empty list must be an error")
+	}
+
+	if list.Error() != "one\ntwo" {
+		t.Errorf("wrong list error. got=%q", list.Error())
+	}
+}
@@ -0,0 +1,98 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Fprint - render the diagnostic for humans, with an excerpt
+// of the offending source line and a caret underline
+//
+//	error[P001]: expected next token to be ), got ; instead
+//	 --> script.mk:1:11
+//	  |
+//	1 | let x = (1;
+//	  |           ^
+func Fprint(w io.Writer, source string, d *Diagnostic) {
+	fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	var lines []string
+	if source != "" {
+		lines = strings.Split(source, "\n")
+	}
+	printExcerpt(w, lines, d.Span)
+
+	for _, r := range d.Related {
+		fmt.Fprintf(w, "note: %s\n", r.Message)
+		printExcerpt(w, lines, r.Span)
+	}
+
+	if d.Fix != nil {
+		fmt.Fprintf(w, "help: %s\n", d.Fix.Message)
+	}
+}
+
+// FprintAll - render every diagnostic of the list
+func FprintAll(w io.Writer, source string, list List) {
+	for _, d := range list {
+		Fprint(w, source, d)
+	}
+}
+
+func printExcerpt(w io.Writer, lines []string, span Span) {
+	start := span.Start
+	if !start.IsValid() {
+		return
+	}
+
+	fmt.Fprintf(w, " --> %s\n", start)
+
+	if start.Line > len(lines) {
+		return
+	}
+
+	line := strings.TrimRight(lines[start.Line-1], "\r")
+	gutter := strconv.Itoa(start.Line)
+	pad := strings.Repeat(" ", len(gutter))
+
+	fmt.Fprintf(w, "%s |\n", pad)
+	fmt.Fprintf(w, "%s | %s\n", gutter, line)
+
+	// only the line is known, there is no column to point at
+	if start.Column > 0 {
+		fmt.Fprintf(w, "%s | %s\n", pad, underline(line, span))
+	}
+}
+
+// underline - carets below the spanned columns of the line,
+// tabs are kept so the carets line up with the source
+func underline(source string, span Span) string {
+	// columns count code points, not bytes
+	line := []rune(source)
+
+	col := span.Start.Column
+	if col < 1 {
+		col = 1
+	}
+
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > col {
+		width = span.End.Column - col
+	} else if span.End.Line > span.Start.Line && len(line) >= col {
+		width = len(line) - col + 1
+	}
+
+	var out strings.Builder
+	for i := 0; i < col-1; i++ {
+		if i < len(line) && line[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
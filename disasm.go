@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ioanzicu/monkeyd/compiler"
+	"github.com/ioanzicu/monkeyd/vm"
+)
+
+// disasmCommand - monkeyd disasm <file.mk|file.mkc>
+func disasmCommand(arguments []string) int {
+	if len(arguments) != 1 {
+		fmt.Fprintf(os.Stderr, "monkeyd disasm: expected exactly one file\n\n%s", usage)
+		return exitUsage
+	}
+
+	filename := arguments[0]
+
+	var bytecode *compiler.Bytecode
+
+	if filepath.Ext(filename) == compiledExt {
+		var err error
+		bytecode, err = loadBytecode(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "monkeyd: %s\n", err)
+			return exitError
+		}
+	} else {
+		source, program, ok := parseFile(os.Stderr, filename)
+		if !ok {
+			return exitError
+		}
+
+		var err error
+		bytecode, err = compileProgram(program)
+		if err != nil {
+			vm.FprintError(os.Stderr, filename, source, err)
+			return exitError
+		}
+	}
+
+	if err := compiler.Disassemble(os.Stdout, bytecode); err != nil {
+		fmt.Fprintf(os.Stderr, "monkeyd: %s\n", err)
+		return exitError
+	}
+
+	return exitOK
+}
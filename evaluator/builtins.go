@@ -11,4 +11,9 @@ var builtins = map[string]*object.Builtin{
 	"last":  object.GetBuiltinByName("last"),
 	"rest":  object.GetBuiltinByName("rest"),
 	"push":  object.GetBuiltinByName("push"),
+	"int":   object.GetBuiltinByName("int"),
+	"float": object.GetBuiltinByName("float"),
+	"str":   object.GetBuiltinByName("str"),
+	"slice": object.GetBuiltinByName("slice"),
+	"bytes": object.GetBuiltinByName("bytes"),
 }
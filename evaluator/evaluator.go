@@ -2,15 +2,21 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/ioanzicu/monkeyd/ast"
 	"github.com/ioanzicu/monkeyd/object"
+	"github.com/ioanzicu/monkeyd/token"
 )
 
 var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -34,26 +40,75 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
+		if err := checkRedefinition(node.Name, env); err != nil {
+			return err
+		}
+
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.ConstStatement:
+		if err := checkRedefinition(node.Name, env); err != nil {
+			return err
+		}
+
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.SetConst(node.Name.Value, val)
+
+	case *ast.DestructureStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if err := bindPattern(node.Pattern, val, env); err != nil {
+			return atPosition(err, node.Token.Pos)
+		}
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	// EXPRESSIONS
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Env: env, Body: body}
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
@@ -71,19 +126,28 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		positional, named := splitNamedArguments(node.Arguments)
+
+		args := evalArguments(positional, env)
 		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+			return atPosition(args[0], node.Token.Pos)
+		}
+
+		if len(named) > 0 {
+			args = bindNamedArguments(function, args, named, env)
+			if len(args) == 1 && isError(args[0]) {
+				return atPosition(args[0], node.Token.Pos)
+			}
 		}
 
-		return applyFunction(function, args)
+		return atPosition(applyFunction(function, args), node.Token.Pos)
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return atPosition(evalPrefixExpression(node.Operator, right), node.Token.Pos)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
@@ -91,18 +155,25 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return left
 		}
 
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, left, env)
+		}
+
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return atPosition(evalInfixExpression(node.Operator, left, right), node.Token.Pos)
 
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return atPosition(evalIdentifier(node, env), node.Token.Pos)
+
+	case *ast.AssignExpression:
+		return atPosition(evalAssignExpression(node, env), node.Token.Pos)
 
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env) // array object
@@ -113,7 +184,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return atPosition(evalIndexExpression(left, index), node.Token.Pos)
 	}
 
 	return nil
@@ -166,6 +237,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -191,9 +264,15 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
+	// a BigInt index is always out of range
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
+	idx := integer.Value
+
 	if idx < 0 || idx > max { // out of range check
 		return NULL
 	}
@@ -201,11 +280,31 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+// evalStringIndexExpression - the code point at the index,
+// as a one character string
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return NULL
+	}
+
+	char, ok := str.(*object.String).CharAt(integer.Value)
+	if !ok {
+		return NULL
+	}
+
+	return char
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
+
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 
@@ -221,14 +320,52 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendFunctionEnv - bind the arguments to the parameters, the extra
+// ones to the rest parameter, and compute the default of each
+// parameter without an argument, in order, so it sees the ones
+// before it. A parameter is null until its default is computed, a
+// nil argument is one that named arguments left out
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
+	err := object.CheckArity(len(args), len(fn.Parameters), fn.NumDefaults(), fn.Rest != nil)
+	if err != nil {
+		return nil, newError("%s", err)
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if passedArgument(args, paramIdx) {
+			env.Set(param.Value, args[paramIdx])
+		} else {
+			env.Set(param.Value, NULL)
+		}
+	}
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+	}
+
+	for paramIdx := range fn.Parameters {
+		if passedArgument(args, paramIdx) {
+			continue
+		}
+
+		val := Eval(fn.Defaults[paramIdx], env)
+		if isError(val) {
+			return nil, val
+		}
+		env.Set(fn.Parameters[paramIdx].Value, val)
 	}
 
-	return env
+	return env, nil
+}
+
+func passedArgument(args []object.Object, paramIdx int) bool {
+	return paramIdx < len(args) && args[paramIdx] != nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -239,6 +376,95 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
+// evalArguments - like evalExpressions, the elements of a
+// ...spread array are passed one by one
+func evalArguments(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		evaluated := Eval(spread.Value, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+
+		elements, err := object.SpreadArguments(evaluated)
+		if err != nil {
+			return []object.Object{newError("%s", err)}
+		}
+		result = append(result, elements...)
+	}
+
+	return result
+}
+
+// splitNamedArguments - the positional arguments and the named
+// ones, which the parser only accepts after them
+func splitNamedArguments(exps []ast.Expression) ([]ast.Expression, []*ast.NamedArgument) {
+	var named []*ast.NamedArgument
+
+	for i, e := range exps {
+		if arg, ok := e.(*ast.NamedArgument); ok {
+			named = append(named, arg)
+			continue
+		}
+
+		if len(named) == 0 {
+			continue
+		}
+
+		return exps[:i], named
+	}
+
+	return exps[:len(exps)-len(named)], named
+}
+
+// bindNamedArguments - evaluate the named arguments and place them
+// with the positional args in the order of the parameters
+func bindNamedArguments(function object.Object, args []object.Object, named []*ast.NamedArgument, env *object.Environment) []object.Object {
+	names := make([]string, len(named))
+	values := make([]object.Object, len(named))
+
+	for i, arg := range named {
+		value := Eval(arg.Value, env)
+		if isError(value) {
+			return []object.Object{value}
+		}
+
+		names[i], values[i] = arg.Name.Value, value
+	}
+
+	fn, ok := function.(*object.Function)
+	if !ok {
+		if _, ok := function.(*object.Builtin); ok {
+			return []object.Object{newError("%s does not take named arguments", function.Type())}
+		}
+
+		return []object.Object{newError("%s", "not a function: "+function.Type())}
+	}
+
+	parameters := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		parameters[i] = param.Value
+	}
+
+	bound, err := object.BindNamedArguments(parameters, fn.NumDefaults(), fn.Rest != nil, args, names, values)
+	if err != nil {
+		return []object.Object{newError("%s", err)}
+	}
+
+	return bound
+}
+
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
@@ -265,6 +491,142 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("%s", "identifier not found: "+node.Value)
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return evalVariableAssignment(target.Value, node, env)
+	case *ast.IndexExpression:
+		return evalIndexAssignment(target, node, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+func evalVariableAssignment(name string, node *ast.AssignExpression, env *object.Environment) object.Object {
+	current, ok := env.Get(name)
+	if !ok {
+		if _, ok := builtins[name]; ok {
+			return newError("cannot assign to builtin %s", name)
+		}
+		return newError("%s", "identifier not found: "+name)
+	}
+
+	if env.IsConst(name) {
+		return newError("cannot assign to constant %s", name)
+	}
+
+	val := evalAssignedValue(node, current, env)
+	if isError(val) {
+		return val
+	}
+
+	env.Assign(name, val)
+	return val
+}
+
+// checkRedefinition - a const can not be defined again in its
+// own environment, an enclosed one can shadow it
+func checkRedefinition(name *ast.Identifier, env *object.Environment) object.Object {
+	if env.DefinesConst(name.Value) {
+		return atPosition(newError("cannot redefine constant %s", name.Value), name.Token.Pos)
+	}
+
+	return nil
+}
+
+// bindPattern - bind the names of the pattern to the parts of val,
+// each part is taken like `val[i]` would take it
+func bindPattern(pattern ast.Pattern, val object.Object, env *object.Environment) object.Object {
+	switch pattern := pattern.(type) {
+
+	case *ast.Identifier:
+		if err := checkRedefinition(pattern, env); err != nil {
+			return err
+		}
+		env.Set(pattern.Value, val)
+
+	case *ast.ArrayPattern:
+		for i, element := range pattern.Elements {
+			part := evalIndexExpression(val, &object.Integer{Value: int64(i)})
+			if isError(part) {
+				return part
+			}
+
+			if err := bindPattern(element, part, env); err != nil {
+				return err
+			}
+		}
+
+		if pattern.Rest != nil {
+			rest, err := object.Rest(val, len(pattern.Elements))
+			if err != nil {
+				return newError("%s", err)
+			}
+
+			if err := bindPattern(pattern.Rest, rest, env); err != nil {
+				return err
+			}
+		}
+
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			part := evalIndexExpression(val, &object.String{Value: pair.Key.Value})
+			if isError(part) {
+				return part
+			}
+
+			if err := bindPattern(pair.Value, part, env); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	return nil
+}
+
+func evalIndexAssignment(target *ast.IndexExpression, node *ast.AssignExpression, env *object.Environment) object.Object {
+	left := Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	index := Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	var current object.Object
+	if node.Operator != "=" {
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+	}
+
+	val := evalAssignedValue(node, current, env)
+	if isError(val) {
+		return val
+	}
+
+	if err := object.SetIndex(left, index, val); err != nil {
+		return newError("%s", err)
+	}
+
+	return val
+}
+
+// evalAssignedValue - the right side of the assignment, combined
+// with the current value when it is compound: x += y -> x = x + y
+func evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) || node.Operator == "=" {
+		return val
+	}
+
+	return evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, val)
+}
+
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 
@@ -273,15 +635,119 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
 	}
 
+	// a block that does not end with an expression gives null
+	if result == nil {
+		return NULL
+	}
+
 	return result
 }
 
+// evalWhileStatement - every iteration runs the body
+// in an environment of its own
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		result := evalBlockStatement(node.Body, object.NewEnclosedEnvironment(env))
+		if exit, done := loopExit(result); done {
+			return exit
+		}
+	}
+}
+
+// evalForStatement - the init statement runs in an environment
+// around the loop, so its variables live across the iterations
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if node.Init != nil {
+		if init := Eval(node.Init, loopEnv); isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if node.Condition != nil {
+			condition := Eval(node.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+
+			if !isTruthy(condition) {
+				return nil
+			}
+		}
+
+		result := evalBlockStatement(node.Body, object.NewEnclosedEnvironment(loopEnv))
+		if exit, done := loopExit(result); done {
+			return exit
+		}
+
+		if node.Post != nil {
+			if post := Eval(node.Post, loopEnv); isError(post) {
+				return post
+			}
+		}
+	}
+}
+
+// evalForInStatement - the variable is bound in the environment
+// of the iteration, a closure keeps the element it was created for
+func evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	iterator, err := object.NewIterator(iterable)
+	if err != nil {
+		return atPosition(newError("%s", err), node.Token.Pos)
+	}
+
+	for {
+		element, ok := iterator.Next()
+		if !ok {
+			return nil
+		}
+
+		iterationEnv := object.NewEnclosedEnvironment(env)
+		iterationEnv.Set(node.Variable.Value, element)
+
+		result := evalBlockStatement(node.Body, iterationEnv)
+		if exit, done := loopExit(result); done {
+			return exit
+		}
+	}
+}
+
+// loopExit - whether the result of an iteration ends the loop,
+// a return or an error is passed on, a break is dropped
+func loopExit(result object.Object) (object.Object, bool) {
+	switch result.(type) {
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	case *object.Break:
+		return nil, true
+	default:
+		return nil, false
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -295,6 +761,11 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		if !object.IsInteger(right) {
+			return newError("unknown operator: ~%s", right.Type())
+		}
+		return object.NotInteger(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -314,18 +785,22 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.NegateInteger(right)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+	case object.IsInteger(left) && object.IsInteger(right):
 		return evalIntegerInfixExpression(operator, left, right)
+	case object.IsNumeric(left) && object.IsNumeric(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -340,25 +815,100 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return object.AddIntegers(left, right)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return object.SubIntegers(left, right)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return object.MulIntegers(left, right)
 	case "/":
-		if rightVal == 0 { // invalid
-			return &object.Integer{Value: -1}
+		if object.IsZeroInteger(right) {
+			return newError("division by zero")
+		}
+		return object.DivIntegers(left, right)
+	case "%":
+		if object.IsZeroInteger(right) {
+			return newError("modulo by zero")
+		}
+		return object.ModIntegers(left, right)
+	case "&":
+		return object.AndIntegers(left, right)
+	case "|":
+		return object.OrIntegers(left, right)
+	case "^":
+		return object.XorIntegers(left, right)
+	case "<<", ">>":
+		count, err := object.ShiftCount(right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if operator == "<<" {
+			return object.ShiftLeftInteger(left, count)
 		}
-		return &object.Integer{Value: leftVal / rightVal}
+		return object.ShiftRightInteger(left, count)
+	case "<":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(object.CompareIntegers(left, right) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalLogicalExpression - `&&` and `||` evaluate the right
+// operand only when the left one does not decide the result,
+// which is always a boolean
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Environment) object.Object {
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+// evalFloatInfixExpression - at least one operand is a float,
+// the other one is converted to a float
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := object.ToFloat(left)
+	rightVal := object.ToFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -378,6 +928,24 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	return &object.String{Value: leftVal + rightVal}
 }
 
+// evalInterpolatedString - concatenate the display form of every part
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		value := Eval(part, env)
+		if isError(value) {
+			return value
+		}
+
+		out.WriteString(value.Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// evalIfExpression - the branches run in an environment of their
+// own, a `let` inside them is not seen after the if
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 	if isError(condition) {
@@ -385,9 +953,9 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 
 	if isTruthy(condition) { // if
-		return Eval(ie.Consequence, env)
+		return evalBlockStatement(ie.Consequence, object.NewEnclosedEnvironment(env))
 	} else if ie.Alternative != nil { // else
-		return Eval(ie.Alternative, env)
+		return evalBlockStatement(ie.Alternative, object.NewEnclosedEnvironment(env))
 	} else {
 		return NULL
 	}
@@ -410,9 +978,25 @@ func newError(format string, a ...any) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// atPosition - attach the position of the failing node
+// to an error that does not carry a more precise one
+func atPosition(obj object.Object, pos token.Position) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = pos
+	}
+
+	return obj
+}
+
+// isError - whether the evaluation stops with obj: an error, or a
+// break or a continue on its way out of the expressions around it
+// to its loop
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		switch obj.Type() {
+		case object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+			return true
+		}
 	}
 	return false
 }
@@ -36,6 +36,29 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1e3", 1000},
+		{"0.5 + 0.25", 0.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"10.0 - 2 * 3", 4},
+		{"float(3)", 3},
+		{`float("2.5")`, 2.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -60,6 +83,23 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 1.5", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"a\"", true},
+		{"1 < 2 && 2 < 3", true},
+		{"let f = fn() { 1 / 0 }; false && f()", false},
+		{"let f = fn() { 1 / 0 }; true || f()", true},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
 	}
 
 	for i, tt := range tests {
@@ -109,6 +149,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool, i int) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -232,6 +285,38 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey D."}[fn(x) { x }]`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"10 / 0",
+			"division by zero",
+		},
+		{
+			"let f = fn(x) { 10 / x }; f(5) + f(0)",
+			"division by zero",
+		},
+		{
+			"x = 1",
+			"identifier not found: x",
+		},
+		{
+			"len = 1",
+			"cannot assign to builtin len",
+		},
+		{
+			"let x = 1; x += true",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"[1, 2][3] = 0",
+			"index out of range: 3 with length 2",
+		},
+		{
+			`{}[fn(x) { x }] = 1`,
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`"abc"[0] = "x"`,
+			"index assignment not supported: STRING",
+		},
 	}
 
 	for _, tt := range tests {
@@ -250,6 +335,82 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedLine int
+		expectedCol  int
+	}{
+		{"1 +\n10 / 0", 2, 4},
+		{"let f = fn(x) {\n  x / 0\n};\nf(1)", 2, 5},
+		{"let x = 1;\n  foobar", 2, 3},
+		{"-true", 1, 1},
+		{"len(1)", 1, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Pos.Line != tt.expectedLine || errObj.Pos.Column != tt.expectedCol {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%s",
+				tt.input, tt.expectedLine, tt.expectedCol, errObj.Pos)
+		}
+	}
+}
+
+func TestIntegerOverflowPromotes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808"},
+		{"4611686018427387904 * 2", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"99999999999999999999 * 99999999999999999999", "9999999999999999999800000000000000000001"},
+		{"99999999999999999999 / 3", "33333333333333333333"},
+		{"-99999999999999999999 / 7", "-14285714285714285714"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		bigInt, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("object is not BigInt. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if bigInt.Inspect() != tt.expected {
+			t.Errorf("wrong value for %q. want=%s, got=%s", tt.input, tt.expected, bigInt.Inspect())
+		}
+	}
+}
+
+func TestBigIntDemotes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"99999999999999999999 - 99999999999999999998", 1},
+		{"99999999999999999999 / 99999999999999999999", 1},
+		{"-9223372036854775808", -9223372036854775807 - 1},
+		{"int(\"123456789012345678901234567890\") / 1000000000000000000000", 123456789},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -320,6 +481,216 @@ addTwo(2);`
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a = 1, b = a * 2) { a * 10 + b }; f(3)", 36},
+		{"let f = fn(head, ...tail) { len(tail) * 10 + tail[0] }; f(1, 2, 3)", 22},
+		{"let f = fn(a, b = 5, ...c) { a + b + len(c) }; f(1, 2, 3, 4)", 5},
+		{"let f = fn(xs = []) { xs[len(xs)] = 1; len(xs) }; f(); f()", 1},
+		{"let f = fn(x = 1, g = fn() { x }) { x = 7; g() }; f()", 7},
+		{"let add = fn(a, b, c) { a * 100 + b * 10 + c }; add(1, ...[2], 3)", 123},
+		{"let add = fn(a, b, c) { a * 100 + b * 10 + c }; let xs = [2, 3]; add(...[], 1, ...xs)", 123},
+		{"len(...[[1, 2]])", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testNullObject(t, testEval("let f = fn(a = b, b = 1) { a }; f()"))
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fn(x) { x }();", "wrong number of arguments: want=1, got=0"},
+		{"fn(x) { x }(1, 2);", "wrong number of arguments: want=1, got=2"},
+		{"fn(x, y = 1) { x }();", "wrong number of arguments: want=1 to 2, got=0"},
+		{"fn(x, ...y) { x }();", "wrong number of arguments: want=at least 1, got=0"},
+		{"fn(x) { x }(...1);", "spread argument must be ARRAY, got INTEGER"},
+		{"fn(x = 1 / 0) { x }();", "division by zero"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2", 3},
+		{"let x = 10; x -= 2; x *= 3; x /= 4; x", 6},
+		{"let x = 1; let y = 2; x = y = 5; x + y", 10},
+		{"let x = 1; let f = fn() { x = x + 10 }; f(); f(); x", 21},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		// the assignment rebinds the parameter, not the outer x
+		{"let x = 1; let f = fn(x) { x = 5 }; f(0); x", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; while (i < 5) { i += 1; } i", 5},
+		{"let n = 0; while (true) { n += 1; if (n == 3) { break; } } n", 3},
+		{"let s = 0; for (let i = 0; i < 5; i += 1) { if (i % 2 == 0) { continue; } s += i; } s", 4},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x; } s", 6},
+		{"let n = 0; for (;;) { n += 1; if (n > 9) { break; } } n", 10},
+		{"let f = fn() { for (x in [4, 5, 6]) { if (x > 4) { return x; } } }; f()", 5},
+		{"let fns = []; for (x in [1, 2]) { fns = push(fns, fn() { x }); } fns[0]() + fns[1]() * 10", 21},
+		{"let fns = []; for (let i = 0; i < 2; i += 1) { fns = push(fns, fn() { i }); } fns[0]()", 2},
+		// the body does not leak its variables
+		{"let y = 1; while (y < 2) { let y = 5; y += 1; break; } y", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	for _, input := range []string{"let f = fn() { while (false) { } }; f()", "if (true) { let a = 1; }"} {
+		testNullObject(t, testEval(input))
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (true) { let x = x + 1; x }", 2},
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let f = fn(x) { if (true) { let x = 10; }; x }; f(1)", 1},
+		{"let a = 1; if (true) { let a = 5; let g = fn() { a }; g() }", 5},
+		{"let f = fn() { let a = 1; if (a) { let a = a * 3; a = a + 1; a } else { 0 } }; f()", 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("if (true) { let hidden = 1; }; hidden")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: hidden" {
+		t.Errorf("block variable visible after the block. got=%s", evaluated.Inspect())
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"const a = 5; a * 2", 10},
+		{"const a = -5; const b = a; b", -5},
+		{"const a = [1, 2]; a[0] = 9; a[0]", 9},
+		{"const a = 1; if (true) { const a = 2; a }", 2},
+		{"const a = 1; let f = fn() { let a = 2; a += 1; a }; f() + a", 4},
+		{"let x = 1; const c = x; x = 5; c", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"const a = 1; a = 2;", "cannot assign to constant a"},
+		{"const a = 1; a += 2;", "cannot assign to constant a"},
+		{"const a = 1; let f = fn() { a = 2 }; f()", "cannot assign to constant a"},
+		{"const a = 1; const a = 2;", "cannot redefine constant a"},
+		{"const a = 1; let a = 2;", "cannot redefine constant a"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestDestructureStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, ...rest] = [1, 2, 3]; len(rest) * 10 + rest[0]", 22},
+		{"let {name, age: years} = {\"name\": 1, \"age\": 23}; name + years", 24},
+		{"let {pos: [x, y]} = {\"pos\": [3, 4]}; x * y", 12},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; a * 10 + b", 21},
+		{"let f = fn(pair) { let [k, v] = pair; fn() { k - v } }; f([10, 4])()", 6},
+		{"let s = 0; for (let [i, n] = [0, 3]; i < n; i += 1) { s += i; }; s", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testNullObject(t, testEval("let [a, b, c] = [1, 2]; c"))
+	testNullObject(t, testEval("let {missing} = {}; missing"))
+
+	errorTests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let [a] = 5;", "index operator not supported: INTEGER"},
+		{"let [a, [b]] = [1];", "index operator not supported: NULL"},
+		{"let [...r] = {};", "rest pattern not supported: HASH"},
+		{"const a = 1; let [a] = [2];", "cannot redefine constant a"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -348,6 +719,31 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "D."; "monkey ${name}"`, "monkey D."},
+		{`"${1 + 2} ${true} ${[1, "a"]} ${{"k": 2}["k"]}"`, "3 true [1, a] 2"},
+		{`"nested ${"in${1}ner"}!"`, "nested in1ner!"},
+		{`let f = fn(x) { "<${x}>" }; "${f(1)}${f(2)}"`, "<1><2>"},
+		{`"\${literal}"`, "${literal}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T(%+v)", evaluated, evaluated)
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -358,6 +754,14 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments, got=2, want=1"},
+		{`len("日本語")`, 3},
+		{`len(bytes("日本語"))`, 9},
+		{`slice("abc", "1")`, "indices of `slice` must be INTEGER, got STRING"},
+		{`int(3.99)`, 3},
+		{`int(-3.99)`, -3},
+		{`int("42")`, 42},
+		{`int("4.2")`, `could not parse "4.2" as INTEGER`},
+		{`float(true)`, "argument to `float` not supported, got BOOLEAN"},
 	}
 
 	for _, tt := range tests {
@@ -540,3 +944,22 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestIndexAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1, 2, 3]; a[1] = 20; a[1]", 20},
+		{"let a = [1, 2, 3]; a[2] += 5", 8},
+		{"let a = []; a[0] = 1; a[len(a)] = 2; len(a)", 2},
+		{"let a = [0]; let b = a; b[0] = 7; a[0]", 7},
+		{`let h = {}; h["one"] = 1; h["two"] = 2; h["one"] + h["two"]`, 3},
+		{`let h = {"n": 1}; h["n"] -= 5; h["n"]`, -4},
+		{"let m = [[0, 0], [0, 0]]; m[1][0] = 5; m[1][0]", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
@@ -1,8 +1,12 @@
 package lexer
 
 import (
-	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/ioanzicu/monkeyd/diagnostic"
 	"github.com/ioanzicu/monkeyd/token"
 )
 
@@ -10,18 +14,137 @@ type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination, a decoded code point
+
+	filename string // name reported in token positions
+	line     int    // line of the current char, starting at 1
+	column   int    // column of the current char, starting at 1
+
+	mode Mode
+
+	// open braces of every enclosing string interpolation,
+	// the innermost last, its closing } resumes the string
+	interpolations []int
 }
 
+// Mode - options controlling what the lexer emits
+type Mode uint
+
+const (
+	// ScanComments - emit comments as token.COMMENT instead of skipping them
+	ScanComments Mode = 1 << iota
+)
+
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename - like New, but every token position
+// produced by the lexer carries the given file name
+func NewWithFilename(filename, input string) *Lexer {
+	return NewWithMode(filename, input, 0)
+}
+
+// NewWithMode - like NewWithFilename, with the given options
+func NewWithMode(filename, input string, mode Mode) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1, mode: mode}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
+// skipShebang - ignore a leading "#!" interpreter line so scripts
+// can be executed directly, the newline is kept to preserve line numbers
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
 func (l *Lexer) NextToken() token.Token {
-	l.skipWhitespace()
+	for {
+		l.skipWhitespace()
+
+		pos := l.currentPosition()
 
+		var tok token.Token
+		if l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+			tok = l.readComment(pos)
+
+			if tok.Type == token.COMMENT && l.mode&ScanComments == 0 {
+				continue
+			}
+		} else {
+			tok = l.readToken()
+		}
+
+		tok.Pos = pos
+		tok.End = l.currentPosition()
+
+		if tok.Type == token.EOF {
+			tok.End = pos
+		}
+
+		return tok
+	}
+}
+
+// readComment - read a `//` comment up to the end of the line or a
+// `/* */` comment, which may nest, and advance past it
+func (l *Lexer) readComment(start token.Position) token.Token {
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+
+		return token.Token{Type: token.COMMENT, Literal: l.input[position:l.position]}
+	}
+
+	// skip the opening "/*"
+	l.readChar()
+	l.readChar()
+
+	for depth := 1; depth > 0; {
+		switch {
+
+		case l.ch == 0:
+			return token.Token{
+				Type:    token.ILLEGAL,
+				Literal: l.input[position:l.position],
+				Error: diagnostic.Errorf(
+					diagnostic.UnterminatedComment,
+					diagnostic.Span{Start: start, End: l.currentPosition()},
+					"block comment not terminated",
+				),
+			}
+
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+			l.readChar()
+
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+			l.readChar()
+
+		default:
+			l.readChar()
+		}
+	}
+
+	return token.Token{Type: token.COMMENT, Literal: l.input[position:l.position]}
+}
+
+// readToken - read the token starting at the current char
+// and advance past it
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
 	switch l.ch {
@@ -52,16 +175,68 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '"':
+		var interpolates bool
+		tok.Literal, interpolates, tok.Error = l.readString()
+
+		tok.Type = token.STRING
+		if interpolates {
+			tok.Type = token.STRING_HEAD
+		}
+	case '`':
 		tok.Type = token.STRING
-		tok.Literal, tok.Error = l.readString()
+		tok.Literal, tok.Error = l.readRawString()
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.SHIFT_LEFT, Literal: "<<"}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.SHIFT_RIGHT, Literal: ">>"}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = l.illegalToken()
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -69,17 +244,38 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.readOperator(token.PLUS, token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.readOperator(token.MINUS, token.MINUS_ASSIGN)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.readOperator(token.ASTERISK, token.ASTERISK_ASSIGN)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.readOperator(token.SLASH, token.SLASH_ASSIGN)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		n := len(l.interpolations)
+		if n == 0 || l.interpolations[n-1] > 0 {
+			if n > 0 {
+				l.interpolations[n-1]--
+			}
+			tok = newToken(token.RBRACE, l.ch)
+			break
+		}
+
+		// end of ${...}, continue with the rest of the string
+		l.interpolations = l.interpolations[:n-1]
+
+		var interpolates bool
+		tok.Literal, interpolates, tok.Error = l.readString()
+
+		tok.Type = token.STRING_TAIL
+		if interpolates {
+			tok.Type = token.STRING_MID
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -95,11 +291,17 @@ func (l *Lexer) NextToken() token.Token {
 			// no need to readChar as readIdentifier reads past the identifier
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal, tok.Error = l.readNumber()
 			return tok
+		} else if l.ch == utf8.RuneError && l.readPosition-l.position == 1 {
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[l.position:l.readPosition]}
+			tok.Error = diagnostic.Errorf(
+				diagnostic.IllegalCharacter,
+				diagnostic.Span{Start: l.currentPosition(), End: l.nextPosition()},
+				"invalid UTF-8 encoding",
+			)
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = l.illegalToken()
 		}
 	}
 
@@ -107,45 +309,222 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// illegalToken - the current char as an ILLEGAL token
+func (l *Lexer) illegalToken() token.Token {
+	tok := newToken(token.ILLEGAL, l.ch)
+	tok.Error = diagnostic.Errorf(
+		diagnostic.IllegalCharacter,
+		diagnostic.Span{Start: l.currentPosition(), End: l.nextPosition()},
+		"illegal character %q", l.ch,
+	)
+	return tok
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	width := 0
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII code for "NUL"
 	} else {
-		l.ch = l.input[l.readPosition]
+		// invalid UTF-8 decodes as utf8.RuneError of width 1
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 
 	// position is prev readPosition
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
+	l.column += 1
 }
 
-func (l *Lexer) readString() (string, error) {
-	// current position on '"'
-	position := l.position + 1
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+// nextPosition - position right after the current char
+func (l *Lexer) nextPosition() token.Position {
+	pos := l.currentPosition()
+	pos.Offset = l.readPosition
+	pos.Column++
+	return pos
+}
+
+// readString - read a double quoted string and decode its escapes,
+// the first invalid escape is reported, lexing resumes after the string
+//
+// The string is read up to the closing '"' or up to the next "${",
+// then interpolates is true and the lexer emits the tokens of the
+// embedded expression until its closing '}'
+func (l *Lexer) readString() (literal string, interpolates bool, err error) {
+	start := l.currentPosition()
+
+	var out strings.Builder
 
 	// keep reading till '"'
 	for {
 		l.readChar()
 
 		if l.ch == 0 || l.ch == '\n' {
-			return "", errors.New("string literal not terminated")
+			return "", false, diagnostic.Errorf(
+				diagnostic.UnterminatedString,
+				diagnostic.Span{Start: start, End: l.currentPosition()},
+				"string literal not terminated",
+			)
 		}
 
 		if l.ch == '"' {
 			break
 		}
 
-		// escape '"'
+		if l.ch == '$' && l.peekChar() == '{' {
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			return out.String(), true, err
+		}
+
+		if l.ch != '\\' {
+			// the source bytes, so invalid UTF-8 is kept as is
+			out.WriteString(l.input[l.position:l.readPosition])
+			continue
+		}
+
+		if escapeErr := l.readEscape(&out); escapeErr != nil && err == nil {
+			err = escapeErr
+		}
+	}
+
+	return out.String(), false, err
+}
+
+// escapes - single character escape sequences
+var escapes = map[rune]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'\'': '\'',
+	'\\': '\\',
+	'$':  '$',
+}
+
+// readEscape - decode the escape sequence starting at the
+// current '\\', the current char is left on its last char
+//
+//	\n \t \r \0 \" \' \\ \$ single characters
+//	\xHH               ASCII character, HH at most 7F
+//	\u{H...}           Unicode code point, 1 to 6 hex digits
+func (l *Lexer) readEscape(out *strings.Builder) error {
+	start := l.currentPosition()
+
+	invalid := func(format string, a ...any) error {
+		return diagnostic.Errorf(
+			diagnostic.InvalidEscape,
+			diagnostic.Span{Start: start, End: l.nextPosition()},
+			format, a...,
+		)
+	}
+
+	if l.peekChar() == 0 || l.peekChar() == '\n' {
+		return nil // reported as an unterminated string
+	}
+	l.readChar()
+
+	if ch, ok := escapes[l.ch]; ok {
+		out.WriteByte(ch)
+		return nil
+	}
+
+	switch l.ch {
+
+	case 'x':
+		digits := l.readHexDigits(2)
+		value, err := strconv.ParseUint(digits, 16, 8)
+		if len(digits) != 2 || err != nil {
+			return invalid("\\x escape needs exactly 2 hex digits")
+		}
+
+		if value > unicode.MaxASCII {
+			return invalid("\\x%s is not an ASCII character, use \\u{%s}", digits, digits)
+		}
+
+		out.WriteByte(byte(value))
+		return nil
+
+	case 'u':
+		if l.peekChar() != '{' {
+			return invalid("\\u escape needs the form \\u{H...}")
+		}
+		l.readChar()
+
+		digits := l.readHexDigits(6)
+		if l.peekChar() != '}' || len(digits) == 0 {
+			return invalid("\\u escape needs 1 to 6 hex digits followed by }")
+		}
+		l.readChar()
+
+		value, _ := strconv.ParseUint(digits, 16, 32)
+		if value > unicode.MaxRune || value >= 0xD800 && value <= 0xDFFF {
+			return invalid("\\u{%s} is not a valid Unicode code point", digits)
+		}
+
+		out.WriteRune(rune(value))
+		return nil
+
+	default:
+		return invalid("unknown escape sequence \\%c", l.ch)
 	}
+}
+
+// readHexDigits - read up to max hex digits following the current char
+func (l *Lexer) readHexDigits(max int) string {
+	position := l.readPosition
+
+	for i := 0; i < max && isHexDigit(l.peekChar()); i++ {
+		l.readChar()
+	}
+
+	return l.input[position:l.readPosition]
+}
+
+// readRawString - read a backtick string, which has
+// no escapes and may span multiple lines
+func (l *Lexer) readRawString() (string, error) {
+	start := l.currentPosition()
+	position := l.position + 1
+
+	for {
+		l.readChar()
+
+		if l.ch == 0 {
+			return "", diagnostic.Errorf(
+				diagnostic.UnterminatedString,
+				diagnostic.Span{Start: start, End: l.currentPosition()},
+				"raw string literal not terminated",
+			)
+		}
 
-	return l.input[position:l.position], nil
+		if l.ch == '`' {
+			return l.input[position:l.position], nil
+		}
+	}
 }
-func (l *Lexer) peekChar() byte {
+
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
 
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -164,26 +543,188 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber - read an integer or a float literal, a float has
+// a fraction `3.14`, an exponent `1e-9` or both `2.5E+3`. An
+// integer may have a base prefix `0xFF`, `0o755`, `0b1010` and
+// any number may group its digits with underscores `1_000_000`
+func (l *Lexer) readNumber() (token.TokenType, string, error) {
+	start := l.currentPosition()
 	position := l.position
+	var tokenType token.TokenType = token.INT
+
+	if l.ch == '0' {
+		if base, name := numberBase(l.peekChar()); base != 0 {
+			return l.readPrefixedInteger(base, name)
+		}
+	}
 
-	for isDigit(l.ch) {
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits()
 	}
 
-	return l.input[position:l.position]
+	if l.ch == 'e' || l.ch == 'E' {
+		tokenType = token.FLOAT
+		l.readChar()
+
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+
+		if !isDigit(l.ch) {
+			return tokenType, l.input[position:l.position], diagnostic.Errorf(
+				diagnostic.InvalidNumber,
+				diagnostic.Span{Start: start, End: l.currentPosition()},
+				"exponent of %s has no digits", l.input[position:l.position],
+			)
+		}
+
+		l.readDigits()
+	}
+
+	literal := l.input[position:l.position]
+
+	if !validUnderscores(literal, 0, isDigit) {
+		return tokenType, literal, diagnostic.Errorf(
+			diagnostic.InvalidNumber,
+			diagnostic.Span{Start: start, End: l.currentPosition()},
+			"'_' must separate successive digits in %s", literal,
+		)
+	}
+
+	return tokenType, literal, nil
+}
+
+// readPrefixedInteger - `0x`, `0o` or `0b` followed by digits
+// of that base, the base prefix is kept in the literal
+func (l *Lexer) readPrefixedInteger(base int, name string) (token.TokenType, string, error) {
+	start := l.currentPosition()
+	position := l.position
+
+	l.readChar() // 0
+	l.readChar() // x, o or b
+
+	for isHexDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+
+	literal := l.input[position:l.position]
+	span := diagnostic.Span{Start: start, End: l.currentPosition()}
+	digits := literal[2:]
+
+	if strings.Trim(digits, "_") == "" {
+		return token.INT, literal, diagnostic.Errorf(
+			diagnostic.InvalidNumber, span,
+			"%s literal %s has no digits", name, literal,
+		)
+	}
+
+	for i := 0; i < len(digits); i++ {
+		if digits[i] != '_' && digitValue(digits[i]) >= base {
+			return token.INT, literal, diagnostic.Errorf(
+				diagnostic.InvalidNumber, span,
+				"invalid digit '%c' in %s literal %s", digits[i], name, literal,
+			)
+		}
+	}
+
+	if !validUnderscores(literal, 2, isHexDigit) {
+		return token.INT, literal, diagnostic.Errorf(
+			diagnostic.InvalidNumber, span,
+			"'_' must separate successive digits in %s", literal,
+		)
+	}
+
+	return token.INT, literal, nil
+}
+
+// readDigits - decimal digits and the underscores between them
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+// numberBase - base and its name for the character after a
+// leading 0, zero when it is not a base prefix
+func numberBase(ch rune) (int, string) {
+	switch ch {
+	case 'x', 'X':
+		return 16, "hexadecimal"
+	case 'o', 'O':
+		return 8, "octal"
+	case 'b', 'B':
+		return 2, "binary"
+	default:
+		return 0, ""
+	}
+}
+
+// validUnderscores - every `_` after the prefix sits between two
+// digits, or between the base prefix and a digit
+func validUnderscores(literal string, prefixLen int, digit func(rune) bool) bool {
+	for i := prefixLen; i < len(literal); i++ {
+		if literal[i] != '_' {
+			continue
+		}
+
+		afterPrefix := prefixLen > 0 && i == prefixLen
+		if !afterPrefix && !digit(rune(literal[i-1])) {
+			return false
+		}
+
+		if i+1 == len(literal) || !digit(rune(literal[i+1])) {
+			return false
+		}
+	}
+
+	return true
 }
 
-// isLetter - define the allowed characters for the identifier name
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter - define the allowed characters for the identifier name,
+// any Unicode letter so names can be written in any language
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func digitValue(ch byte) int {
+	switch {
+	case isDigit(rune(ch)):
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	default:
+		return 16
+	}
+}
+
+// readOperator - the operator alone or, when `=` follows it,
+// its compound assignment form like `+=`
+func (l *Lexer) readOperator(operator, assign token.TokenType) token.Token {
+	if l.peekChar() != '=' {
+		return newToken(operator, l.ch)
+	}
+
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: assign, Literal: string(ch) + "="}
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{
 		Type:    tokenType,
 		Literal: string(ch),
@@ -16,7 +16,7 @@ func TestNextToken(t *testing.T) {
 
   let result = add(five, ten);
 
-  !-/*5;
+  !-/ *5;
   5 < 10 > 9;
 
   if (5 < 10) {
@@ -151,3 +151,556 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Filename: "test.mk", Offset: 0, Line: 1, Column: 1}, token.Position{Filename: "test.mk", Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 4, Line: 1, Column: 5}, token.Position{Filename: "test.mk", Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Filename: "test.mk", Offset: 6, Line: 1, Column: 7}, token.Position{Filename: "test.mk", Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Filename: "test.mk", Offset: 8, Line: 1, Column: 9}, token.Position{Filename: "test.mk", Offset: 9, Line: 1, Column: 10}},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 9, Line: 1, Column: 10}, token.Position{Filename: "test.mk", Offset: 10, Line: 1, Column: 11}},
+		{token.IDENT, token.Position{Filename: "test.mk", Offset: 13, Line: 2, Column: 3}, token.Position{Filename: "test.mk", Offset: 14, Line: 2, Column: 4}},
+		{token.PLUS, token.Position{Filename: "test.mk", Offset: 15, Line: 2, Column: 5}, token.Position{Filename: "test.mk", Offset: 16, Line: 2, Column: 6}},
+		{token.STRING, token.Position{Filename: "test.mk", Offset: 17, Line: 2, Column: 7}, token.Position{Filename: "test.mk", Offset: 21, Line: 2, Column: 11}},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Offset: 21, Line: 2, Column: 11}, token.Position{Filename: "test.mk", Offset: 22, Line: 2, Column: 12}},
+		{token.EOF, token.Position{Filename: "test.mk", Offset: 22, Line: 2, Column: 12}, token.Position{Filename: "test.mk", Offset: 22, Line: 2, Column: 12}},
+	}
+
+	l := NewWithFilename("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - token pos wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End != tt.expectedEnd {
+			t.Errorf("tests[%d] - token end wrong. expected=%+v, got=%+v", i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestUnicodeSource(t *testing.T) {
+	input := "let café = \"naïve 日本\"; 名前 ≠"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.LET, "let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, "café", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 10, Line: 1, Column: 10}},
+		{token.STRING, "naïve 日本", token.Position{Offset: 12, Line: 1, Column: 12}},
+		{token.SEMICOLON, ";", token.Position{Offset: 27, Line: 1, Column: 22}},
+		{token.IDENT, "名前", token.Position{Offset: 29, Line: 1, Column: 24}},
+		{token.ILLEGAL, "≠", token.Position{Offset: 36, Line: 1, Column: 27}},
+		{token.EOF, "", token.Position{Offset: 39, Line: 1, Column: 28}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - token pos wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	l := New("x \xff \"a\xfeb\"")
+
+	l.NextToken()
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("token type wrong, expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+
+	expected := "1:3: invalid UTF-8 encoding"
+	if tok.Error == nil || tok.Error.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%v", expected, tok.Error)
+	}
+
+	// bytes inside a string are kept as they are
+	if tok := l.NextToken(); tok.Literal != "a\xfeb" {
+		t.Errorf("string literal wrong. expected=%q, got=%q", "a\xfeb", tok.Literal)
+	}
+}
+
+func TestShebangLine(t *testing.T) {
+	input := "#!/usr/bin/env monkeyd\nlet x = 1;"
+
+	l := New(input)
+
+	tok := l.NextToken()
+	if tok.Type != token.LET {
+		t.Fatalf("token type wrong, expected=%q, got=%q", token.LET, tok.Type)
+	}
+
+	if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Errorf("token pos wrong. expected=2:1, got=%s", tok.Pos)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// greeting
+let x = 1; // trailing
+/* block /* nested */ still comment */ x / 2;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     string
+	}{
+		{token.COMMENT, "// greeting", "1:1"},
+		{token.LET, "let", "2:1"},
+		{token.IDENT, "x", "2:5"},
+		{token.ASSIGN, "=", "2:7"},
+		{token.INT, "1", "2:9"},
+		{token.SEMICOLON, ";", "2:10"},
+		{token.COMMENT, "// trailing", "2:12"},
+		{token.COMMENT, "/* block /* nested */ still comment */", "3:1"},
+		{token.IDENT, "x", "3:40"},
+		{token.SLASH, "/", "3:42"},
+		{token.INT, "2", "3:44"},
+		{token.SEMICOLON, ";", "3:45"},
+		{token.EOF, "", "3:46"},
+	}
+
+	l := NewWithMode("", input, ScanComments)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.String() != tt.expectedPos {
+			t.Errorf("tests[%d] - pos wrong. expected=%s, got=%s", i, tt.expectedPos, tok.Pos)
+		}
+	}
+
+	// without ScanComments the comments are skipped
+	l = New(input)
+
+	for i, tt := range tests {
+		if tt.expectedType == token.COMMENT {
+			continue
+		}
+
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := "let x = 1; /* open /* nested */\nstill open"
+
+	l := New(input)
+	for i := 0; i < 5; i++ {
+		l.NextToken()
+	}
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("token type wrong, expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+
+	if tok.Error == nil {
+		t.Fatalf("expected an error on the token")
+	}
+
+	expected := "1:12: block comment not terminated"
+	if tok.Error.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, tok.Error)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF after the comment, got=%q", tok.Type)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedError   string
+	}{
+		{`"line\nnext"`, "line\nnext", ""},
+		{`"a\tb\rc"`, "a\tb\rc", ""},
+		{`"say \"hi\""`, `say "hi"`, ""},
+		{`"it\'s \\ ok"`, `it's \ ok`, ""},
+		{`"nul\0"`, "nul\x00", ""},
+		{`"\x41\x7f"`, "A\x7f", ""},
+		{`"\u{1F600} \u{e9}"`, "😀 é", ""},
+		{`"\u{0}"`, "\x00", ""},
+		{`"héllo"`, "héllo", ""},
+		{`"\q"`, "", `1:2: unknown escape sequence \q`},
+		{`"\x4"`, "", `1:2: \x escape needs exactly 2 hex digits`},
+		{`"\x80"`, "", `1:2: \x80 is not an ASCII character, use \u{80}`},
+		{`"\u1F60"`, "", `1:2: \u escape needs the form \u{H...}`},
+		{`"\u{}"`, "", `1:2: \u escape needs 1 to 6 hex digits followed by }`},
+		{`"\u{1234567}"`, "", `1:2: \u escape needs 1 to 6 hex digits followed by }`},
+		{`"\u{110000}"`, "", `1:2: \u{110000} is not a valid Unicode code point`},
+		{`"\u{D800}"`, "", `1:2: \u{D800} is not a valid Unicode code point`},
+		{`"ok \q \z"`, "", `1:5: unknown escape sequence \q`},
+		{`"abc\`, "", `1:1: string literal not terminated`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("input %s - token type wrong, expected=%q, got=%q", tt.input, token.STRING, tok.Type)
+		}
+
+		if tt.expectedError != "" {
+			if tok.Error == nil || tok.Error.Error() != tt.expectedError {
+				t.Errorf("input %s - wrong error. expected=%q, got=%v", tt.input, tt.expectedError, tok.Error)
+			}
+			continue
+		}
+
+		if tok.Error != nil {
+			t.Errorf("input %s - unexpected error: %s", tt.input, tok.Error)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("input %s - literal wrong. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("input %s - expected EOF after the string, got=%q", tt.input, next.Type)
+		}
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	input := "let json = `{\n  \"name\": \"monkey\\n\"\n}`;"
+
+	l := New(input)
+	for i := 0; i < 3; i++ {
+		l.NextToken()
+	}
+
+	tok := l.NextToken()
+	if tok.Type != token.STRING {
+		t.Fatalf("token type wrong, expected=%q, got=%q", token.STRING, tok.Type)
+	}
+
+	expected := "{\n  \"name\": \"monkey\\n\"\n}"
+	if tok.Literal != expected {
+		t.Errorf("literal wrong. expected=%q, got=%q", expected, tok.Literal)
+	}
+
+	semicolon := l.NextToken()
+	if semicolon.Type != token.SEMICOLON || semicolon.Pos.String() != "3:3" {
+		t.Errorf("wrong token after the raw string. got=%q at %s", semicolon.Type, semicolon.Pos)
+	}
+
+	tok = New("`never closed\n").NextToken()
+	if tok.Error == nil || tok.Error.Error() != "1:1: raw string literal not terminated" {
+		t.Errorf("wrong error for unterminated raw string. got=%v", tok.Error)
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"Hi ${name}, ${ {"a": 1}["a"] } \${x} ${"in${2}"}!"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_HEAD, "Hi "},
+		{token.IDENT, "name"},
+		{token.STRING_MID, ", "},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "a"},
+		{token.RBRACKET, "]"},
+		{token.STRING_MID, " ${x} "},
+		{token.STRING_HEAD, "in"},
+		{token.INT, "2"},
+		{token.STRING_TAIL, ""},
+		{token.STRING_TAIL, "!"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Error != nil {
+			t.Errorf("tests[%d] - unexpected error: %s", i, tok.Error)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `a <= b >= c < d > e && f || g % h & i | j ^ ~k << l >> m += n -= o *= p /= q = ...r`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.GT, ">"},
+		{token.IDENT, "e"},
+		{token.AND, "&&"},
+		{token.IDENT, "f"},
+		{token.OR, "||"},
+		{token.IDENT, "g"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "h"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "i"},
+		{token.PIPE, "|"},
+		{token.IDENT, "j"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "k"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.IDENT, "l"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.IDENT, "m"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.IDENT, "n"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.IDENT, "o"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.IDENT, "p"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.IDENT, "q"},
+		{token.ASSIGN, "="},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "r"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	input := `while for in break continue forever`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IDENT, "forever"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestConstKeyword(t *testing.T) {
+	input := `const constant`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.CONST, "const"},
+		{token.IDENT, "constant"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := `5 3.14 0.5 1e-9 2.5E+3 7e2 [1.5] 0xFF 0Xff 0o755 0b1010 1_000_000 0x_dead_BEEF 1_000.000_5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E+3"},
+		{token.FLOAT, "7e2"},
+		{token.LBRACKET, "["},
+		{token.FLOAT, "1.5"},
+		{token.RBRACKET, "]"},
+		{token.INT, "0xFF"},
+		{token.INT, "0Xff"},
+		{token.INT, "0o755"},
+		{token.INT, "0b1010"},
+		{token.INT, "1_000_000"},
+		{token.INT, "0x_dead_BEEF"},
+		{token.FLOAT, "1_000.000_5"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Error != nil {
+			t.Errorf("tests[%d] - unexpected error: %s", i, tok.Error)
+		}
+	}
+}
+
+func TestMalformedIntegers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedError   string
+	}{
+		{"0x;", "0x", "1:1: hexadecimal literal 0x has no digits"},
+		{"0b_;", "0b_", "1:1: binary literal 0b_ has no digits"},
+		{"0b102;", "0b102", "1:1: invalid digit '2' in binary literal 0b102"},
+		{"0o78;", "0o78", "1:1: invalid digit '8' in octal literal 0o78"},
+		{"1_000_;", "1_000_", "1:1: '_' must separate successive digits in 1_000_"},
+		{"1__0;", "1__0", "1:1: '_' must separate successive digits in 1__0"},
+		{"0xFF_;", "0xFF_", "1:1: '_' must separate successive digits in 0xFF_"},
+		{"1_.5;", "1_.5", "1:1: '_' must separate successive digits in 1_.5"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q - literal wrong. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Error == nil {
+			t.Errorf("%q - expected an error on the token", tt.input)
+			continue
+		}
+
+		if tok.Error.Error() != tt.expectedError {
+			t.Errorf("%q - wrong error. expected=%q, got=%q", tt.input, tt.expectedError, tok.Error)
+		}
+	}
+}
+
+func TestExponentWithoutDigits(t *testing.T) {
+	l := New("let x = 1e+;")
+	for i := 0; i < 3; i++ {
+		l.NextToken()
+	}
+
+	tok := l.NextToken()
+	if tok.Type != token.FLOAT {
+		t.Fatalf("token type wrong, expected=%q, got=%q", token.FLOAT, tok.Type)
+	}
+
+	if tok.Error == nil {
+		t.Fatalf("expected an error on the token")
+	}
+
+	expected := "1:9: exponent of 1e+ has no digits"
+	if tok.Error.Error() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, tok.Error)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.SEMICOLON {
+		t.Errorf("expected SEMICOLON after the number, got=%q", tok.Type)
+	}
+}
@@ -8,7 +8,57 @@ import (
 	"github.com/ioanzicu/monkeyd/repl"
 )
 
+const usage = `Usage:
+
+	monkeyd                                   start the interactive REPL
+	monkeyd repl                              start the interactive REPL
+	monkeyd run [--engine=vm|eval] <file> [args...]
+	                                          execute a Monkey script
+	monkeyd <file> [args...]                  same as monkeyd run <file>
+	monkeyd build [-o out.mkc] <file>         compile a Monkey script to bytecode
+	monkeyd exec <file.mkc> [args...]         execute compiled bytecode
+	monkeyd disasm <file.mk|file.mkc>         print the compiled bytecode
+`
+
 func main() {
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+// dispatch - run the command named by the first argument and return
+// the exit status. A script file in place of the command is run, that
+// is how a `#!/usr/bin/env monkeyd` line starts it
+func dispatch(arguments []string) int {
+	if len(arguments) == 0 {
+		startRepl()
+		return exitOK
+	}
+
+	switch arguments[0] {
+	case "repl":
+		startRepl()
+	case "run":
+		return runCommand(arguments[1:])
+	case "build":
+		return buildCommand(arguments[1:])
+	case "exec":
+		return execCommand(arguments[1:])
+	case "disasm":
+		return disasmCommand(arguments[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		if info, err := os.Stat(arguments[0]); err == nil && !info.IsDir() {
+			return runCommand(arguments)
+		}
+
+		fmt.Fprintf(os.Stderr, "monkeyd: unknown command %q\n\n%s", arguments[0], usage)
+		return exitUsage
+	}
+
+	return exitOK
+}
+
+func startRepl() {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
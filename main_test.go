@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDispatchRunsScriptFile(t *testing.T) {
+	dir := t.TempDir()
+
+	script := filepath.Join(dir, "check.mk")
+	source := "#!/usr/bin/env monkeyd\nif (len(args[0]) != 2) { 1 / 0 }\n"
+	if err := os.WriteFile(script, []byte(source), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := filepath.Join(dir, "builtin.mk")
+	if err := os.WriteFile(failing, []byte("len(1);\nputs(\"after\");\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arguments []string
+		expected  int
+	}{
+		{[]string{script, "ok"}, exitOK},
+		{[]string{script, "nope"}, exitError},
+		{[]string{"run", script, "ok"}, exitOK},
+		{[]string{"run", failing}, exitError},
+		{[]string{"run", "--engine=eval", failing}, exitError},
+		{[]string{filepath.Join(dir, "missing.mk")}, exitUsage},
+		{[]string{dir}, exitUsage},
+	}
+
+	for _, tt := range tests {
+		if status := dispatch(tt.arguments); status != tt.expected {
+			t.Errorf("dispatch(%q) - wrong exit status. want=%d, got=%d", tt.arguments, tt.expected, status)
+		}
+	}
+}
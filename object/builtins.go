@@ -1,6 +1,11 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -18,7 +23,7 @@ var Builtins = []struct {
 				case *Array:
 					return &Integer{Value: int64(len(arg.Elements))}
 				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
+					return &Integer{Value: int64(arg.Len())}
 				default:
 					return newError("argument to `len` not supported, got %s", args[0].Type())
 				}
@@ -124,6 +129,136 @@ var Builtins = []struct {
 			},
 		},
 	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInt:
+					return arg
+				case *Float:
+					// truncated toward zero, like a conversion in Go
+					if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+						return newError("cannot convert %s to INTEGER", arg.Inspect())
+					}
+					value, _ := big.NewFloat(arg.Value).Int(nil)
+					return IntegerFromBig(value)
+				case *String:
+					value, ok := new(big.Int).SetString(arg.Value, 10)
+					if !ok {
+						return newError("could not parse %q as INTEGER", arg.Value)
+					}
+					return IntegerFromBig(value)
+				default:
+					return newError("argument to `int` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"float",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInt:
+					return &Float{Value: ToFloat(arg)}
+				case *Float:
+					return arg
+				case *String:
+					value, err := strconv.ParseFloat(arg.Value, 64)
+					if err != nil {
+						return newError("could not parse %q as FLOAT", arg.Value)
+					}
+					return &Float{Value: value}
+				default:
+					return newError("argument to `float` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"str",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				if str, ok := args[0].(*String); ok {
+					return str
+				}
+
+				return &String{Value: args[0].Inspect()}
+			},
+		},
+	},
+	{
+		"slice",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 && len(args) != 3 {
+					return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+				}
+
+				for _, arg := range args[1:] {
+					if _, ok := arg.(*Integer); !ok {
+						return newError("indices of `slice` must be INTEGER, got %s", arg.Type())
+					}
+				}
+
+				start := args[1].(*Integer).Value
+				end := int64(math.MaxInt64)
+				if len(args) == 3 {
+					end = args[2].(*Integer).Value
+				}
+
+				switch arg := args[0].(type) {
+				case *String:
+					return arg.Slice(start, end)
+				case *Array:
+					length := int64(len(arg.Elements))
+					start = min(max(start, 0), length)
+					end = min(max(end, start), length)
+
+					newElements := make([]Object, end-start)
+					copy(newElements, arg.Elements[start:end])
+					return &Array{Elements: newElements}
+				default:
+					return newError("argument to `slice` must be STRING or ARRAY, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"bytes",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				str, ok := args[0].(*String)
+				if !ok {
+					return newError("argument to `bytes` must be STRING, got %s", args[0].Type())
+				}
+
+				elements := make([]Object, str.ByteLen())
+				for i, b := range str.Bytes() {
+					elements[i] = &Integer{Value: int64(b)}
+				}
+
+				return &Array{Elements: elements}
+			},
+		},
+	},
 }
 
 func newError(format string, a ...interface{}) *Error {
@@ -0,0 +1,74 @@
+package object
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// CheckArity - an error when numArgs arguments can not be passed to
+// numParameters parameters, the last numDefaults of them optional and
+// any extra ones packed when the function is variadic
+func CheckArity(numArgs, numParameters, numDefaults int, variadic bool) error {
+	required := numParameters - numDefaults
+	if numArgs >= required && (variadic || numArgs <= numParameters) {
+		return nil
+	}
+
+	want := strconv.Itoa(numParameters)
+	switch {
+	case variadic:
+		want = fmt.Sprintf("at least %d", required)
+	case numDefaults > 0:
+		want = fmt.Sprintf("%d to %d", required, numParameters)
+	}
+
+	return fmt.Errorf("wrong number of arguments: want=%s, got=%d", want, numArgs)
+}
+
+// SpreadArguments - the elements of an array spread into the
+// arguments of a call with ...
+func SpreadArguments(obj Object) ([]Object, error) {
+	arr, ok := obj.(*Array)
+	if !ok {
+		return nil, fmt.Errorf("spread argument must be ARRAY, got %s", obj.Type())
+	}
+
+	return arr.Elements, nil
+}
+
+// BindNamedArguments - the arguments in the order of the parameters,
+// the positional ones first and each named one in the slot of its
+// parameter. A parameter without an argument is nil, only one with
+// a default can be left out
+func BindNamedArguments(parameters []string, numDefaults int, variadic bool, positional []Object, names []string, values []Object) ([]Object, error) {
+	numParameters := len(parameters)
+
+	if len(positional) > numParameters && !variadic {
+		return nil, CheckArity(len(positional)+len(names), numParameters, numDefaults, variadic)
+	}
+
+	args := make([]Object, max(numParameters, len(positional)))
+	copy(args, positional)
+
+	for i, name := range names {
+		param := slices.Index(parameters, name)
+		if param < 0 {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+
+		if args[param] != nil {
+			return nil, fmt.Errorf("parameter %s already has an argument", name)
+		}
+
+		args[param] = values[i]
+	}
+
+	for i := 0; i < numParameters-numDefaults; i++ {
+		if args[i] == nil {
+			return nil, fmt.Errorf("missing argument for parameter %s", parameters[i])
+		}
+	}
+
+	return args, nil
+}
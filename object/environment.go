@@ -12,8 +12,9 @@ func NewEnvironment() *Environment {
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	consts map[string]bool
+	outer  *Environment
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -26,5 +27,48 @@ func (e *Environment) Get(name string) (Object, bool) {
 
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
+	delete(e.consts, name)
 	return val
 }
+
+// SetConst - bind name to val, Assign refuses to rebind it
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+
+	e.store[name] = val
+	e.consts[name] = true
+	return val
+}
+
+// IsConst - the innermost environment that defines name
+// bound it with SetConst
+func (e *Environment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env.consts[name]
+		}
+	}
+
+	return false
+}
+
+// DefinesConst - name is a const of this environment,
+// an enclosed one can shadow it
+func (e *Environment) DefinesConst(name string) bool {
+	return e.consts[name]
+}
+
+// Assign - rebind name in the innermost environment that
+// defines it, false when none of them does
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,66 @@
+package object
+
+import (
+	"fmt"
+	"math"
+)
+
+// SetIndex - store value in an array or a hash, an index equal to
+// the length of an array appends to it, any other index outside
+// the array is an error
+func SetIndex(collection, index, value Object) error {
+	switch collection := collection.(type) {
+
+	case *Array:
+		if !IsInteger(index) {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+
+		length := int64(len(collection.Elements))
+
+		// a BigInt index is always out of range
+		i, ok := index.(*Integer)
+		if !ok || i.Value < 0 || i.Value > length {
+			return fmt.Errorf("index out of range: %s with length %d", index.Inspect(), length)
+		}
+
+		if i.Value == length {
+			collection.Elements = append(collection.Elements, value)
+		} else {
+			collection.Elements[i.Value] = value
+		}
+
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+
+		collection.Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+
+	default:
+		return fmt.Errorf("index assignment not supported: %s", collection.Type())
+	}
+
+	return nil
+}
+
+// Rest - elements of an array, or code points of a string, from
+// start on, what the ...rest of an array pattern binds
+func Rest(collection Object, start int) (Object, error) {
+	switch collection := collection.(type) {
+
+	case *Array:
+		start = min(start, len(collection.Elements))
+
+		elements := make([]Object, len(collection.Elements)-start)
+		copy(elements, collection.Elements[start:])
+		return &Array{Elements: elements}, nil
+
+	case *String:
+		return collection.Slice(int64(start), math.MaxInt64), nil
+
+	default:
+		return nil, fmt.Errorf("rest pattern not supported: %s", collection.Type())
+	}
+}
@@ -0,0 +1,60 @@
+package object
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Iterator - walks the elements of an array or the characters
+// of a string, what a `for (x in ...)` loop goes through
+type Iterator struct {
+	next func() (Object, bool)
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Next - the next element, false once they are exhausted
+func (it *Iterator) Next() (Object, bool) {
+	return it.next()
+}
+
+// NewIterator - an array is walked up to the length it had when
+// the loop started, a string by code point
+func NewIterator(obj Object) (*Iterator, error) {
+	switch obj := obj.(type) {
+
+	case *Array:
+		length := len(obj.Elements)
+		i := 0
+
+		return &Iterator{next: func() (Object, bool) {
+			if i >= length {
+				return nil, false
+			}
+
+			// read through the array, an element assigned
+			// during the loop is seen
+			el := obj.Elements[i]
+			i++
+			return el, true
+		}}, nil
+
+	case *String:
+		offset := 0
+
+		return &Iterator{next: func() (Object, bool) {
+			if offset >= len(obj.Value) {
+				return nil, false
+			}
+
+			_, width := utf8.DecodeRuneInString(obj.Value[offset:])
+			char := &String{Value: obj.Value[offset : offset+width]}
+			offset += width
+			return char, true
+		}}, nil
+
+	default:
+		return nil, fmt.Errorf("cannot iterate over %s", obj.Type())
+	}
+}
@@ -0,0 +1,248 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// IsNumeric - integers and floats can be mixed in arithmetic
+// and comparisons
+func IsNumeric(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt, *Float:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsInteger - a machine integer or a big integer
+func IsInteger(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt:
+		return true
+	default:
+		return false
+	}
+}
+
+// ToFloat - value of a numeric object as a float, an integer
+// beyond 2^53 is rounded to the nearest float
+func ToFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
+// ToBigInt - value of an integer object as a new big.Int
+func ToBigInt(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInt:
+		return new(big.Int).Set(obj.Value)
+	default:
+		return new(big.Int)
+	}
+}
+
+// IntegerFromBig - an Integer when the value fits in int64,
+// a BigInt otherwise
+func IntegerFromBig(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+
+	return &BigInt{Value: value}
+}
+
+// AddIntegers - sum of two integer objects, promoted to a BigInt
+// when it does not fit in int64
+func AddIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		sum := l + r
+		// overflow when both operands have the sign the sum lacks
+		if (l^sum)&(r^sum) >= 0 {
+			return &Integer{Value: sum}
+		}
+	}
+
+	return IntegerFromBig(new(big.Int).Add(ToBigInt(left), ToBigInt(right)))
+}
+
+func SubIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		diff := l - r
+		// overflow when the operands differ in sign and the
+		// difference does not have the sign of the left one
+		if (l^r)&(l^diff) >= 0 {
+			return &Integer{Value: diff}
+		}
+	}
+
+	return IntegerFromBig(new(big.Int).Sub(ToBigInt(left), ToBigInt(right)))
+}
+
+func MulIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		if l == 0 || r == 0 {
+			return &Integer{Value: 0}
+		}
+
+		product := l * r
+		if product/r == l && !(l == -1 && r == math.MinInt64) && !(r == -1 && l == math.MinInt64) {
+			return &Integer{Value: product}
+		}
+	}
+
+	return IntegerFromBig(new(big.Int).Mul(ToBigInt(left), ToBigInt(right)))
+}
+
+// DivIntegers - quotient truncated toward zero, the caller
+// reports division by zero before calling it
+func DivIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		if !(l == math.MinInt64 && r == -1) {
+			return &Integer{Value: l / r}
+		}
+	}
+
+	return IntegerFromBig(new(big.Int).Quo(ToBigInt(left), ToBigInt(right)))
+}
+
+// ModIntegers - remainder of the truncated division, it has the
+// sign of the dividend so (a / b) * b + a % b == a. The caller
+// reports a zero divisor before calling it
+func ModIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		// Go defines math.MinInt64 % -1 as 0
+		return &Integer{Value: l % r}
+	}
+
+	return IntegerFromBig(new(big.Int).Rem(ToBigInt(left), ToBigInt(right)))
+}
+
+func NegateInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok && i.Value != math.MinInt64 {
+		return &Integer{Value: -i.Value}
+	}
+
+	return IntegerFromBig(new(big.Int).Neg(ToBigInt(obj)))
+}
+
+// AndIntegers, OrIntegers, XorIntegers and NotInteger - bitwise
+// operations, a BigInt behaves as an infinite two's complement
+func AndIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		return &Integer{Value: l & r}
+	}
+
+	return IntegerFromBig(new(big.Int).And(ToBigInt(left), ToBigInt(right)))
+}
+
+func OrIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		return &Integer{Value: l | r}
+	}
+
+	return IntegerFromBig(new(big.Int).Or(ToBigInt(left), ToBigInt(right)))
+}
+
+func XorIntegers(left, right Object) Object {
+	if l, r, ok := smallIntegers(left, right); ok {
+		return &Integer{Value: l ^ r}
+	}
+
+	return IntegerFromBig(new(big.Int).Xor(ToBigInt(left), ToBigInt(right)))
+}
+
+func NotInteger(obj Object) Object {
+	if i, ok := obj.(*Integer); ok {
+		return &Integer{Value: ^i.Value}
+	}
+
+	return IntegerFromBig(new(big.Int).Not(ToBigInt(obj)))
+}
+
+// ShiftCount - the right operand of a shift, an error when it
+// is negative or exceeds 63
+func ShiftCount(obj Object) (uint, error) {
+	sign := ToBigInt(obj).Sign()
+	count, ok := obj.(*Integer)
+
+	switch {
+	case sign < 0:
+		return 0, fmt.Errorf("negative shift count: %s", obj.Inspect())
+	case !ok || count.Value > 63:
+		return 0, fmt.Errorf("shift count too large: %s", obj.Inspect())
+	default:
+		return uint(count.Value), nil
+	}
+}
+
+// ShiftLeftInteger - promoted to a BigInt when bits are
+// shifted out of int64
+func ShiftLeftInteger(obj Object, count uint) Object {
+	if i, ok := obj.(*Integer); ok {
+		if shifted := i.Value << count; shifted>>count == i.Value {
+			return &Integer{Value: shifted}
+		}
+	}
+
+	return IntegerFromBig(new(big.Int).Lsh(ToBigInt(obj), count))
+}
+
+// ShiftRightInteger - arithmetic shift, the sign is kept
+func ShiftRightInteger(obj Object, count uint) Object {
+	if i, ok := obj.(*Integer); ok {
+		return &Integer{Value: i.Value >> count}
+	}
+
+	return IntegerFromBig(new(big.Int).Rsh(ToBigInt(obj), count))
+}
+
+// CompareIntegers - -1, 0 or +1 as left is less than, equal to
+// or greater than right
+func CompareIntegers(left, right Object) int {
+	if l, r, ok := smallIntegers(left, right); ok {
+		switch {
+		case l < r:
+			return -1
+		case l > r:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return ToBigInt(left).Cmp(ToBigInt(right))
+}
+
+// IsZeroInteger - a BigInt is never zero, that always fits in int64
+func IsZeroInteger(obj Object) bool {
+	i, ok := obj.(*Integer)
+	return ok && i.Value == 0
+}
+
+func smallIntegers(left, right Object) (int64, int64, bool) {
+	l, ok := left.(*Integer)
+	if !ok {
+		return 0, 0, false
+	}
+
+	r, ok := right.(*Integer)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return l.Value, r.Value, true
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/ioanzicu/monkeyd/ast"
 	"github.com/ioanzicu/monkeyd/code"
+	"github.com/ioanzicu/monkeyd/token"
 )
 
 type ObjectType string
@@ -18,10 +22,13 @@ const (
 	ERROR_OBJ ObjectType = "ERROR"
 
 	INTEGER_OBJ ObjectType = "INTEGER"
+	FLOAT_OBJ   ObjectType = "FLOAT"
 	BOOLEAN_OBJ ObjectType = "BOOLEAN"
 	STRING_OBJ  ObjectType = "STRING"
 
 	RETURN_VALUE_OBJ ObjectType = "RETURN_VALUE"
+	BREAK_OBJ        ObjectType = "BREAK"
+	CONTINUE_OBJ     ObjectType = "CONTINUE"
 
 	FUNCTION_OBJ ObjectType = "FUNCTION"
 	BUILTIN_OBJ  ObjectType = "BUILTIN"
@@ -31,10 +38,13 @@ const (
 
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ           = "CLOSURE"
+	CELL_OBJ              = "CELL"
+	ITERATOR_OBJ          = "ITERATOR"
 )
 
 type Error struct {
 	Message string
+	Pos     token.Position // position of the failing expression, if known
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -47,11 +57,26 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue - signals of the evaluator, they unwind
+// the blocks up to the innermost loop like a ReturnValue does
+// up to the function
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
 }
 
+// Integer - 64-bit two's complement, arithmetic promotes
+// to a BigInt on overflow
 type Integer struct {
 	Value int64
 }
@@ -59,6 +84,34 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprint(i.Value) }
 
+// BigInt - an integer outside the int64 range, to scripts it is
+// just an INTEGER. Build it with IntegerFromBig so a value that
+// fits is always an Integer
+type BigInt struct {
+	Value *big.Int
+}
+
+func (bi *BigInt) Type() ObjectType { return INTEGER_OBJ }
+func (bi *BigInt) Inspect() string  { return bi.Value.String() }
+
+// Float - IEEE 754 double precision, division by zero
+// gives an infinity or NaN instead of an error
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+
+	// keep floats distinguishable from integers, 3.0 not 3
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -73,17 +126,38 @@ func (n *Null) Inspect() string  { return "null" }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // default value of each parameter, nil when it has none
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
 
+// NumDefaults - the parameters with a default are the last ones
+func (f *Function) NumDefaults() int {
+	n := 0
+	for _, def := range f.Defaults {
+		if def != nil {
+			n++
+		}
+	}
+	return n
+}
+
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn")
@@ -151,6 +225,29 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (bi *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte{byte(bi.Value.Sign() + 1)})
+	h.Write(bi.Value.Bytes())
+
+	return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
+// HashKey - a float with an integral value is the same key as
+// the equal integer, so h[1] and h[1.0] find the same pair
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return HashKey{Type: INTEGER_OBJ, Value: uint64(int64(f.Value))}
+	}
+
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		value, _ := big.NewFloat(f.Value).Int(nil)
+		return IntegerFromBig(value).(Hashable).HashKey()
+	}
+
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -196,6 +293,13 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	NumDefaults   int  // trailing parameters with a default, OpDefault fills them in
+	Variadic      bool // the local after the parameters packs the extra arguments
+
+	ParameterNames []string // what named arguments are matched against
+
+	Name  string         // name of the let binding, empty for anonymous functions
+	Lines code.LineTable // source lines of the instructions
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -205,10 +309,26 @@ func (cf *CompiledFunction) Inspect() string {
 
 type Closure struct {
 	Fn   *CompiledFunction
-	Free []Object
+	Free []*Cell
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Cell - a variable captured by a closure, the frame that declared
+// it and every closure over it share the cell, so an assignment
+// through one of them is seen by all. Programs never see a cell,
+// reading the variable yields the value inside
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	if c.Value == nil {
+		return "Cell[]"
+	}
+	return fmt.Sprintf("Cell[%s]", c.Value.Inspect())
+}
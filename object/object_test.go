@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +24,308 @@ func TestStringHashKey(t *testing.T) {
 		t.Error("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	if (&Float{Value: 2.0}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Error("integral float and equal integer have different hash keys")
+	}
+
+	if (&Float{Value: 2.5}).HashKey() != (&Float{Value: 2.5}).HashKey() {
+		t.Error("floats with same value have different hash keys")
+	}
+
+	if (&Float{Value: 2.5}).HashKey() == (&Float{Value: 3.5}).HashKey() {
+		t.Error("floats with different values have same hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{3.14, "3.14"},
+		{-0.5, "-0.5"},
+		{1e-9, "1e-09"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect for %g. want=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestBigIntHashKey(t *testing.T) {
+	big1, _ := new(big.Int).SetString("99999999999999999999", 10)
+	big2, _ := new(big.Int).SetString("99999999999999999999", 10)
+
+	if (&BigInt{Value: big1}).HashKey() != (&BigInt{Value: big2}).HashKey() {
+		t.Error("big integers with same value have different hash keys")
+	}
+
+	if (&BigInt{Value: big1}).HashKey() == (&BigInt{Value: new(big.Int).Neg(big2)}).HashKey() {
+		t.Error("big integers with opposite signs have same hash keys")
+	}
+
+	if (&Float{Value: 1e20}).HashKey() != IntegerFromBig(big.NewInt(0).Exp(big.NewInt(10), big.NewInt(20), nil)).(Hashable).HashKey() {
+		t.Error("integral float and equal big integer have different hash keys")
+	}
+}
+
+func TestIntegerArithmeticPromotion(t *testing.T) {
+	max := &Integer{Value: 9223372036854775807}
+	min := &Integer{Value: -9223372036854775807 - 1}
+
+	tests := []struct {
+		result   Object
+		expected string
+	}{
+		{AddIntegers(max, &Integer{Value: 1}), "9223372036854775808"},
+		{AddIntegers(min, &Integer{Value: -1}), "-9223372036854775809"},
+		{SubIntegers(min, &Integer{Value: 1}), "-9223372036854775809"},
+		{SubIntegers(&Integer{Value: 0}, min), "9223372036854775808"},
+		{MulIntegers(min, &Integer{Value: -1}), "9223372036854775808"},
+		{MulIntegers(&Integer{Value: -1}, min), "9223372036854775808"},
+		{MulIntegers(max, max), "85070591730234615847396907784232501249"},
+		{DivIntegers(min, &Integer{Value: -1}), "9223372036854775808"},
+		{NegateInteger(min), "9223372036854775808"},
+	}
+
+	for i, tt := range tests {
+		if _, ok := tt.result.(*BigInt); !ok {
+			t.Errorf("tests[%d] - result is not BigInt. got=%T", i, tt.result)
+		}
+
+		if tt.result.Inspect() != tt.expected {
+			t.Errorf("tests[%d] - wrong value. want=%s, got=%s", i, tt.expected, tt.result.Inspect())
+		}
+	}
+
+	if _, ok := SubIntegers(AddIntegers(max, &Integer{Value: 1}), &Integer{Value: 1}).(*Integer); !ok {
+		t.Error("result that fits in int64 is not demoted to Integer")
+	}
+
+	if CompareIntegers(AddIntegers(max, &Integer{Value: 1}), max) != 1 {
+		t.Error("big integer does not compare greater than max int64")
+	}
+}
+
+func TestStringCodePoints(t *testing.T) {
+	str := &String{Value: "añb日"}
+
+	if str.Len() != 4 {
+		t.Errorf("wrong Len. want=4, got=%d", str.Len())
+	}
+
+	if str.ByteLen() != 7 {
+		t.Errorf("wrong ByteLen. want=7, got=%d", str.ByteLen())
+	}
+
+	charTests := []struct {
+		index    int64
+		expected string
+		ok       bool
+	}{
+		{0, "a", true},
+		{1, "ñ", true},
+		{3, "日", true},
+		{4, "", false},
+		{-1, "", false},
+	}
+
+	for _, tt := range charTests {
+		char, ok := str.CharAt(tt.index)
+		if ok != tt.ok {
+			t.Errorf("CharAt(%d) - wrong ok. want=%t, got=%t", tt.index, tt.ok, ok)
+			continue
+		}
+
+		if ok && char.Value != tt.expected {
+			t.Errorf("CharAt(%d) - want=%q, got=%q", tt.index, tt.expected, char.Value)
+		}
+	}
+
+	sliceTests := []struct {
+		start, end int64
+		expected   string
+	}{
+		{1, 3, "ñb"},
+		{0, 100, "añb日"},
+		{-5, 2, "añ"},
+		{3, 1, ""},
+		{10, 20, ""},
+	}
+
+	for _, tt := range sliceTests {
+		if got := str.Slice(tt.start, tt.end).Value; got != tt.expected {
+			t.Errorf("Slice(%d, %d) - want=%q, got=%q", tt.start, tt.end, tt.expected, got)
+		}
+	}
+}
+
+func TestSetIndex(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	if err := SetIndex(arr, &Integer{Value: 0}, &Integer{Value: 5}); err != nil {
+		t.Fatalf("SetIndex error: %s", err)
+	}
+
+	if err := SetIndex(arr, &Integer{Value: 1}, &Integer{Value: 6}); err != nil {
+		t.Fatalf("SetIndex error appending: %s", err)
+	}
+
+	if len(arr.Elements) != 2 || arr.Elements[0].Inspect() != "5" || arr.Elements[1].Inspect() != "6" {
+		t.Errorf("wrong elements. got=%s", arr.Inspect())
+	}
+
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "k"}
+
+	if err := SetIndex(hash, key, &Integer{Value: 7}); err != nil {
+		t.Fatalf("SetIndex error: %s", err)
+	}
+
+	if pair, ok := hash.Pairs[key.HashKey()]; !ok || pair.Value.Inspect() != "7" {
+		t.Errorf("value not stored under the key. got=%s", hash.Inspect())
+	}
+
+	errorTests := []struct {
+		collection Object
+		index      Object
+		expected   string
+	}{
+		{arr, &Integer{Value: 3}, "index out of range: 3 with length 2"},
+		{arr, &Integer{Value: -1}, "index out of range: -1 with length 2"},
+		{arr, &Boolean{Value: true}, "array index must be INTEGER, got BOOLEAN"},
+		{hash, arr, "unusable as hash key: ARRAY"},
+		{key, &Integer{Value: 0}, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range errorTests {
+		err := SetIndex(tt.collection, tt.index, &Null{})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestRest(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}}}
+
+	tests := []struct {
+		collection Object
+		start      int
+		expected   string
+	}{
+		{arr, 1, "[2, 3]"},
+		{arr, 0, "[1, 2, 3]"},
+		{arr, 5, "[]"},
+		{&String{Value: "añb"}, 1, "ñb"},
+		{&String{Value: "a"}, 3, ""},
+	}
+
+	for _, tt := range tests {
+		rest, err := Rest(tt.collection, tt.start)
+		if err != nil {
+			t.Fatalf("Rest error: %s", err)
+		}
+
+		if rest.Inspect() != tt.expected {
+			t.Errorf("Rest(%s, %d) - want=%q, got=%q", tt.collection.Inspect(), tt.start, tt.expected, rest.Inspect())
+		}
+	}
+
+	rest, _ := Rest(arr, 1)
+	rest.(*Array).Elements[0] = &Integer{Value: 9}
+	if arr.Elements[1].Inspect() != "2" {
+		t.Error("rest shares its elements with the array")
+	}
+
+	_, err := Rest(&Hash{}, 0)
+	if err == nil || err.Error() != "rest pattern not supported: HASH" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestCheckArity(t *testing.T) {
+	tests := []struct {
+		numArgs, numParameters, numDefaults int
+		variadic                            bool
+		expected                            string
+	}{
+		{2, 2, 0, false, ""},
+		{1, 2, 0, false, "wrong number of arguments: want=2, got=1"},
+		{1, 3, 2, false, ""},
+		{3, 3, 2, false, ""},
+		{0, 3, 2, false, "wrong number of arguments: want=1 to 3, got=0"},
+		{4, 3, 2, false, "wrong number of arguments: want=1 to 3, got=4"},
+		{9, 1, 0, true, ""},
+		{0, 1, 0, true, "wrong number of arguments: want=at least 1, got=0"},
+		{0, 1, 1, true, ""},
+	}
+
+	for _, tt := range tests {
+		err := CheckArity(tt.numArgs, tt.numParameters, tt.numDefaults, tt.variadic)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != tt.expected {
+			t.Errorf("CheckArity(%d, %d, %d, %t) - want=%q, got=%q",
+				tt.numArgs, tt.numParameters, tt.numDefaults, tt.variadic, tt.expected, got)
+		}
+	}
+
+	if _, err := SpreadArguments(&String{Value: "ab"}); err == nil || err.Error() != "spread argument must be ARRAY, got STRING" {
+		t.Errorf("wrong spread error. got=%v", err)
+	}
+}
+
+func TestBindNamedArguments(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	parameters := []string{"a", "b", "c"}
+
+	tests := []struct {
+		positional []Object
+		names      []string
+		values     []Object
+		variadic   bool
+		expected   string
+	}{
+		{[]Object{one}, []string{"c"}, []Object{two}, false, "1 _ 2"},
+		{nil, []string{"b", "a"}, []Object{two, one}, false, "1 2 _"},
+		{[]Object{one, one, one, two}, nil, nil, true, "1 1 1 2"},
+		{[]Object{one}, []string{"d"}, []Object{two}, false, "unknown parameter d"},
+		{[]Object{one}, []string{"a"}, []Object{two}, false, "parameter a already has an argument"},
+		{nil, []string{"b"}, []Object{two}, false, "missing argument for parameter a"},
+		{[]Object{one, one, one, one}, []string{"c"}, []Object{two}, false, "wrong number of arguments: want=1 to 3, got=5"},
+	}
+
+	for _, tt := range tests {
+		args, err := BindNamedArguments(parameters, 2, tt.variadic, tt.positional, tt.names, tt.values)
+
+		var got string
+		if err != nil {
+			got = err.Error()
+		} else {
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				parts[i] = "_"
+				if arg != nil {
+					parts[i] = arg.Inspect()
+				}
+			}
+			got = strings.Join(parts, " ")
+		}
+
+		if got != tt.expected {
+			t.Errorf("BindNamedArguments(%d positional, %q) - want=%q, got=%q",
+				len(tt.positional), tt.names, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package object
+
+import "unicode/utf8"
+
+// Len - number of code points, what `len`, indexing
+// and `slice` count in
+func (s *String) Len() int {
+	return utf8.RuneCountInString(s.Value)
+}
+
+// ByteLen - size of the UTF-8 encoding in bytes
+func (s *String) ByteLen() int {
+	return len(s.Value)
+}
+
+// Bytes - the raw UTF-8 encoding
+func (s *String) Bytes() []byte {
+	return []byte(s.Value)
+}
+
+// CharAt - code point at index i as a one character string,
+// false when i is out of range
+func (s *String) CharAt(i int64) (*String, bool) {
+	if i < 0 {
+		return nil, false
+	}
+
+	start := runeOffset(s.Value, i)
+	if start == len(s.Value) {
+		return nil, false
+	}
+
+	_, width := utf8.DecodeRuneInString(s.Value[start:])
+	return &String{Value: s.Value[start : start+width]}, true
+}
+
+// Slice - code points from start up to, but not including, end,
+// both are clamped to the bounds of the string
+func (s *String) Slice(start, end int64) *String {
+	start = max(start, 0)
+	end = max(end, start)
+
+	from := runeOffset(s.Value, start)
+	to := from + runeOffset(s.Value[from:], end-start)
+
+	return &String{Value: s.Value[from:to]}
+}
+
+// runeOffset - byte offset of the code point at index i,
+// the length of s when i is beyond its end
+func runeOffset(s string, i int64) int {
+	offset := 0
+
+	for ; i > 0 && offset < len(s); i-- {
+		_, width := utf8.DecodeRuneInString(s[offset:])
+		offset += width
+	}
+
+	return offset
+}
@@ -1,10 +1,14 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
+	"unicode"
 
 	"github.com/ioanzicu/monkeyd/ast"
+	"github.com/ioanzicu/monkeyd/diagnostic"
 	"github.com/ioanzicu/monkeyd/lexer"
 	"github.com/ioanzicu/monkeyd/token"
 )
@@ -14,26 +18,44 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // x = y or x += y, right associative
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
-	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X or !X
+	SUM         // + or the bitwise | and ^
+	PRODUCT     // * or the bitwise & and shifts, as in Go
+	PREFIX      // -X, !X or ~X
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.PIPE:            SUM,
+	token.CARET:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.AMPERSAND:       PRODUCT,
+	token.SHIFT_LEFT:      PRODUCT,
+	token.SHIFT_RIGHT:     PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type (
@@ -43,27 +65,32 @@ type (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors diagnostic.List
 
 	curToken  token.Token
 	peekToken token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	loopDepth int // loops around the statement being parsed, within the function
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: diagnostic.List{},
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.STRING_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
@@ -81,6 +108,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
@@ -92,18 +135,65 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) Errors() []string {
+// Errors - diagnostics reported by the lexer and the parser
+func (p *Parser) Errors() diagnostic.List {
 	return p.errors
 }
 
+func (p *Parser) addError(code diagnostic.Code, span diagnostic.Span, format string, a ...any) *diagnostic.Diagnostic {
+	d := diagnostic.Errorf(code, span, format, a...)
+	p.errors = append(p.errors, d)
+	return d
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := p.addError(
+		diagnostic.UnexpectedToken,
+		diagnostic.TokenSpan(p.peekToken),
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type,
+	)
+
+	// punctuation can be suggested as-is, keywords and literals cannot
+	if isPunctuation(t) {
+		d.Fix = &diagnostic.Fix{
+			Message:     fmt.Sprintf("insert `%s`", t),
+			Span:        diagnostic.Span{Start: p.curToken.End, End: p.curToken.End},
+			Replacement: string(t),
+		}
+	}
+}
+
+func isPunctuation(t token.TokenType) bool {
+	for _, r := range string(t) {
+		if unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// comments carry no meaning for the parser
+	for p.peekToken.Type == token.COMMENT {
+		p.peekToken = p.l.NextToken()
+	}
+
+	// the lexer reports malformed tokens through the token itself
+	if p.peekToken.Error != nil {
+		p.lexerError(p.peekToken)
+	}
+}
+
+func (p *Parser) lexerError(tok token.Token) {
+	if d, ok := tok.Error.(*diagnostic.Diagnostic); ok {
+		p.errors = append(p.errors, d)
+		return
+	}
+
+	p.addError(diagnostic.IllegalCharacter, diagnostic.TokenSpan(tok), "%s", tok.Error)
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -141,12 +231,179 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.CONST:
+		return p.parseConstStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControl()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
+	stmt := p.parseLetDeclaration()
+	if stmt == nil {
+		return nil
+	}
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	binding := p.parseLetBinding()
+	if binding == nil {
+		return nil
+	}
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return &ast.ConstStatement{Token: binding.Token, Name: binding.Name, Value: binding.Value}
+}
+
+// parseLetDeclaration - a let binding a name, or one destructuring
+// the value into a pattern
+func (p *Parser) parseLetDeclaration() ast.Statement {
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		if stmt := p.parseDestructureBinding(); stmt != nil {
+			return stmt
+		}
+		return nil
+	}
+
+	if stmt := p.parseLetBinding(); stmt != nil {
+		return stmt
+	}
+	return nil
+}
+
+// parseDestructureBinding - `let <pattern> = <value>`, without
+// the semicolons after it
+func (p *Parser) parseDestructureBinding() *ast.DestructureStatement {
+	stmt := &ast.DestructureStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Pattern = p.parsePattern()
+	if stmt.Pattern == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+// parsePattern - a name, or an array or a hash pattern
+// starting at the current token
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		p.addError(
+			diagnostic.UnexpectedToken,
+			diagnostic.TokenSpan(p.curToken),
+			"expected a name or a pattern, got %s instead", p.curToken.Type,
+		)
+		return nil
+	}
+}
+
+// parseArrayPattern - [a, [b, c], ...rest], the rest comes last
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	pattern.Rbracket = p.curToken
+
+	return pattern
+}
+
+// parseHashPattern - {name, age: years, pos: [x, y]}
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		key := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		var value ast.Pattern = key
+
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+
+			value = p.parsePattern()
+			if value == nil {
+				return nil
+			}
+		}
+
+		pattern.Pairs = append(pattern.Pairs, ast.HashPatternPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	pattern.Rbrace = p.curToken
+
+	return pattern
+}
+
+// parseLetBinding - `let <name> = <value>`, or a `const` of the same
+// shape, without the semicolons after it, which separate the parts
+// of a `for` loop
+func (p *Parser) parseLetBinding() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
@@ -170,10 +427,150 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		fl.Name = stmt.Name.Value
 	}
 
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) { // ( open
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) { // ) close
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) { // { open
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseForStatement - `for (x in iterable)` when the parentheses
+// start with a name followed by `in`, a C-style loop otherwise
+func (p *Parser) parseForStatement() ast.Statement {
+	forToken := p.curToken
+
+	if !p.expectPeek(token.LPAREN) { // ( open
+		return nil
+	}
+
+	p.nextToken()
+
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IN) {
+		return p.parseForInStatement(forToken)
+	}
+
+	stmt := &ast.ForStatement{Token: forToken}
+
+	switch p.curToken.Type {
+	case token.SEMICOLON:
+		// no init statement
+	case token.LET:
+		init := p.parseLetDeclaration()
+		if init == nil || !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+		stmt.Init = init
+	default:
+		stmt.Init = &ast.ExpressionStatement{
+			Token:      p.curToken,
+			Expression: p.parseExpression(LOWEST),
+		}
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Post = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.RPAREN) { // ) close
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) { // { open
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseForInStatement(forToken token.Token) *ast.ForInStatement {
+	stmt := &ast.ForInStatement{
+		Token:    forToken,
+		Variable: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+	}
+
+	p.nextToken() // `in`
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) { // ) close
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) { // { open
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+
 	for p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
+	return body
+}
+
+// parseLoopControl - `break` or `continue`, only
+// allowed inside a loop of the same function
+func (p *Parser) parseLoopControl() ast.Statement {
+	var stmt ast.Statement = &ast.BreakStatement{Token: p.curToken}
+	if p.curTokenIs(token.CONTINUE) {
+		stmt = &ast.ContinueStatement{Token: p.curToken}
+	}
+
+	if p.loopDepth == 0 {
+		p.addError(
+			diagnostic.MisplacedLoopControl,
+			diagnostic.TokenSpan(p.curToken),
+			"%s outside of a loop", p.curToken.Literal,
+		)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
 	return stmt
 }
 
@@ -257,12 +654,34 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.EOF) {
+		d := p.addError(
+			diagnostic.UnexpectedToken,
+			diagnostic.TokenSpan(p.curToken),
+			"expected next token to be %s, got %s instead", token.RBRACE, token.EOF,
+		)
+		d.Related = append(d.Related, diagnostic.Related{
+			Message: "block opened here",
+			Span:    diagnostic.TokenSpan(block.Token),
+		})
+	}
+
+	block.Rbrace = p.curToken
+
 	return block
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	// already reported by the lexer
+	if t == token.ILLEGAL {
+		return
+	}
+
+	p.addError(
+		diagnostic.MissingExpression,
+		diagnostic.TokenSpan(p.curToken),
+		"no prefix parse function for %s found", t,
+	)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -292,12 +711,50 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	// defer untrace(trace(fmt.Sprintf("parseIntegerLiteral: %v", p.curToken)))
 
+	// a malformed literal was already reported by the lexer
+	if p.curToken.Error != nil {
+		return nil
+	}
+
 	literal := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if value, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			literal.Big = value
+			return literal
+		}
+	}
+
+	if err != nil {
+		p.addError(
+			diagnostic.InvalidInteger,
+			diagnostic.TokenSpan(p.curToken),
+			"could not parse %q as integer", p.curToken.Literal,
+		)
+		return nil
+	}
+
+	literal.Value = value
+
+	return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	// a malformed literal was already reported by the lexer
+	if p.curToken.Error != nil {
+		return nil
+	}
+
+	literal := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(
+			diagnostic.InvalidFloat,
+			diagnostic.TokenSpan(p.curToken),
+			"could not parse %q as float", p.curToken.Literal,
+		)
 		return nil
 	}
 
@@ -337,6 +794,35 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+
+	p.nextToken()
+	// one below ASSIGN so `a = b = c` groups as `a = (b = c)`
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	switch left.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		expression.Target = left
+		return expression
+	case nil:
+		// a missing left side was already reported
+		return nil
+	default:
+		// the span points at the target, which can be only partly
+		// parsed after an error, so it is not rendered
+		p.addError(
+			diagnostic.InvalidAssignment,
+			diagnostic.SpanOf(left),
+			"invalid assignment target",
+		)
+		return nil
+	}
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -344,7 +830,15 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	// a loop around the function does not reach into its
+	// defaults or its body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
+
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) { // ) close
 		return nil
@@ -355,43 +849,120 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseFunctionParameters - a, b = <default>, ...rest. Once a
+// parameter has a default the ones after it need one too, the
+// rest parameter comes last
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
+	lit.Defaults = []ast.Expression{}
 
 	if p.peekTokenIs(token.RPAREN) { // ) close and finish
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
-	p.nextToken()
+	for { // a, b, c, ...
+		p.nextToken()
 
-	ident := &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
-	}
-	identifiers = append(identifiers, ident)
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
 
-	for p.peekTokenIs(token.COMMA) { // a, b, c, ...
-		p.nextToken() // skip comma ',' separator
-		p.nextToken() // move to the next token
 		ident := &ast.Identifier{
 			Token: p.curToken,
 			Value: p.curToken.Literal,
 		}
-		identifiers = append(identifiers, ident)
-	}
 
-	if !p.expectPeek(token.RPAREN) { // ')' close
-		return nil
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken() // skip '='
+			p.nextToken() // move to the default value
+			def = p.parseExpression(LOWEST)
+		} else if n := len(lit.Defaults); n > 0 && lit.Defaults[n-1] != nil {
+			p.addError(
+				diagnostic.InvalidParameter,
+				diagnostic.TokenSpan(ident.Token),
+				"parameter %s without a default follows one with a default", ident.Value,
+			)
+			return false
+		}
+
+		lit.Parameters = append(lit.Parameters, ident)
+		lit.Defaults = append(lit.Defaults, def)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken() // skip comma ',' separator
 	}
 
-	return identifiers
+	return p.expectPeek(token.RPAREN) // ')' close
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseInterpolatedString - STRING_HEAD expression
+// { STRING_MID expression } STRING_TAIL
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+	str.Parts = appendStringSegment(str.Parts, p.curToken)
+
+	for {
+		p.nextToken()
+
+		if p.curTokenIs(token.STRING_MID) || p.curTokenIs(token.STRING_TAIL) {
+			p.addError(
+				diagnostic.MissingExpression,
+				diagnostic.TokenSpan(p.curToken),
+				"expected an expression inside ${}",
+			)
+			return nil
+		}
+
+		exp := p.parseExpression(LOWEST)
+		if exp == nil {
+			return nil
+		}
+		str.Parts = append(str.Parts, exp)
+
+		p.nextToken()
+
+		switch p.curToken.Type {
+
+		case token.STRING_MID:
+			str.Parts = appendStringSegment(str.Parts, p.curToken)
+
+		case token.STRING_TAIL:
+			str.Parts = appendStringSegment(str.Parts, p.curToken)
+			str.Tail = p.curToken
+			return str
+
+		default:
+			p.addError(
+				diagnostic.UnexpectedToken,
+				diagnostic.TokenSpan(p.curToken),
+				"expected } to close the interpolation, got %s instead", p.curToken.Type,
+			)
+			return nil
+		}
+	}
+}
+
+// appendStringSegment - empty segments carry no text and are left out
+func appendStringSegment(parts []ast.Expression, tok token.Token) []ast.Expression {
+	if tok.Literal == "" {
+		return parts
+	}
+
+	return append(parts, &ast.StringLiteral{Token: tok, Value: tok.Literal})
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -408,19 +979,87 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseExpressionList(token.RPAREN, p.parseCallArgument)
+	exp.Rparen = p.curToken
+
+	p.checkNamedArguments(exp.Arguments)
 	return exp
 }
 
+// parseCallArgument - an expression, ...<expression> spreading
+// an array into the arguments or <name>: <expression>
+func (p *Parser) parseCallArgument() ast.Expression {
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+		named := &ast.NamedArgument{
+			Token: p.curToken,
+			Name:  &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+		}
+
+		p.nextToken() // :
+		p.nextToken()
+		named.Value = p.parseExpression(LOWEST)
+
+		return named
+	}
+
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+
+	return spread
+}
+
+// checkNamedArguments - the named arguments come after the
+// positional ones and each name is passed once
+func (p *Parser) checkNamedArguments(args []ast.Expression) {
+	seen := map[string]bool{}
+
+	for _, arg := range args {
+		// a missing argument was already reported
+		if arg == nil {
+			continue
+		}
+
+		named, ok := arg.(*ast.NamedArgument)
+
+		switch {
+		case !ok && len(seen) > 0:
+			p.addError(
+				diagnostic.InvalidArgument,
+				diagnostic.SpanOf(arg),
+				"positional argument follows a named argument",
+			)
+		case ok && seen[named.Name.Value]:
+			p.addError(
+				diagnostic.InvalidArgument,
+				diagnostic.SpanOf(named.Name),
+				"argument %s passed more than once", named.Name.Value,
+			)
+		case ok:
+			seen[named.Name.Value] = true
+		}
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
-	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Elements = p.parseExpressionList(token.RBRACKET, p.parseListElement)
+	array.Rbracket = p.curToken
 
 	return array
 }
 
-func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+// parseListElement - an element of an array literal
+func (p *Parser) parseListElement() ast.Expression {
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseExpressionList(end token.TokenType, parseElement func() ast.Expression) []ast.Expression {
 	list := []ast.Expression{}
 
 	if p.peekTokenIs(end) {
@@ -429,12 +1068,12 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, parseElement())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken() // skip comma ',' separator
 		p.nextToken() // move to the next token
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, parseElement())
 	}
 
 	if !p.expectPeek(end) { // ')' or ']' close
@@ -453,6 +1092,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) { // ']'
 		return nil
 	}
+	exp.Rbracket = p.curToken
 
 	return exp
 }
@@ -482,6 +1122,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.curToken
 
 	return hash
 }
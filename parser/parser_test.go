@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/ioanzicu/monkeyd/ast"
+	"github.com/ioanzicu/monkeyd/diagnostic"
 	"github.com/ioanzicu/monkeyd/lexer"
 )
 
@@ -42,6 +43,102 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      any
+		expectedString     string
+	}{
+		{"const max = 10;", "max", 10, "const max = 10;"},
+		{"const name = other", "name", "other", "const name = other;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ConstStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] not *ast.ConstStatement. got=%T", program.Statements[0])
+		}
+
+		if !testIdentifier(t, stmt.Name, tt.expectedIdentifier) {
+			return
+		}
+
+		if !testLiteralExpression(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+
+		if stmt.String() != tt.expectedString {
+			t.Errorf("wrong String. want=%q, got=%q", tt.expectedString, stmt.String())
+		}
+	}
+}
+
+func TestDestructureStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = pair;", "let [a, b] = pair;"},
+		{"let [head, ...tail] = [1, 2, 3]", "let [head, ...tail] = [1, 2, 3];"},
+		{"let [...all] = xs;", "let [...all] = xs;"},
+		{"let [] = xs;", "let [] = xs;"},
+		{"let {name, age: years} = person;", "let {name, age: years} = person;"},
+		{"let {pos: [x, y], size: {w}} = box;", "let {pos: [x, y], size: {w}} = box;"},
+		{"let [[a, b], {c}] = nested;", "let [[a, b], {c}] = nested;"},
+		{"for (let [i, j] = [0, 9]; i < j; i += 1) { }", "for (let [i, j] = [0, 9]; (i < j); (i += 1)) {  }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q - program.Statements does not contain 1 statement. got=%d",
+				tt.input, len(program.Statements))
+		}
+
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("input %q - wrong statement. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	l := lexer.New("let {name, age: [years]} = person;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.DestructureStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.DestructureStatement. got=%T", program.Statements[0])
+	}
+
+	pattern, ok := stmt.Pattern.(*ast.HashPattern)
+	if !ok || len(pattern.Pairs) != 2 {
+		t.Fatalf("pattern is not a hash pattern with 2 pairs. got=%T (%s)", stmt.Pattern, stmt.Pattern)
+	}
+
+	if pattern.Pairs[0].Key.Value != "name" || pattern.Pairs[0].Value.(*ast.Identifier).Value != "name" {
+		t.Errorf("shorthand pair does not bind its key. got=%+v", pattern.Pairs[0])
+	}
+
+	if _, ok := pattern.Pairs[1].Value.(*ast.ArrayPattern); !ok {
+		t.Errorf("nested pattern is not ast.ArrayPattern. got=%T", pattern.Pairs[1].Value)
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
@@ -171,6 +268,77 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_7fff_ffff", 2147483647},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+
+		// the original spelling is kept for formatting
+		if literal.String() != tt.input {
+			t.Errorf("literal.String() not %q. got=%q", tt.input, literal.String())
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E+3;", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -365,6 +533,26 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"!-a",
 			"(!(-a))",
 		},
+		{
+			"x = y = 1 + 2",
+			"(x = (y = (1 + 2)))",
+		},
+		{
+			"x += a * b || c",
+			"(x += ((a * b) || c))",
+		},
+		{
+			"f(x = 1, y -= 2)",
+			"f((x = 1), (y -= 2))",
+		},
+		{
+			"a[i + 1] += 2 * 3",
+			"((a[(i + 1)]) += (2 * 3))",
+		},
+		{
+			"h[a][b] = c = 1",
+			"(((h[a])[b]) = (c = 1))",
+		},
 		{
 			"a + b + c",
 			"((a + b) + c)",
@@ -465,6 +653,34 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a <= b || c >= d && !e",
+			"((a <= b) || ((c >= d) && (!e)))",
+		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a & mask == 0",
+			"((a & mask) == 0)",
+		},
+		{
+			"a | b ^ c & d",
+			"((a | b) ^ (c & d))",
+		},
+		{
+			"1 << n - 1",
+			"((1 << n) - 1)",
+		},
+		{
+			"~a >> 2",
+			"((~a) >> 2)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -481,6 +697,111 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 	}
 }
 
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedName     string
+		expectedOperator string
+		expectedValue    interface{}
+	}{
+		{"x = 5;", "x", "=", 5},
+		{"y += 1;", "y", "+=", 1},
+		{"z -= foo;", "z", "-=", "foo"},
+		{"a *= true;", "a", "*=", true},
+		{"b /= 2", "b", "/=", 2},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, exp.Target, tt.expectedName) {
+			return
+		}
+
+		if exp.Operator != tt.expectedOperator {
+			t.Fatalf("exp.Operator is not %q. got=%q", tt.expectedOperator, exp.Operator)
+		}
+
+		if !testLiteralExpression(t, exp.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 3) { x += 1; }", "while ((x < 3)) { (x += 1) }"},
+		{"while (true) { break; };", "while (true) { break; }"},
+		{"for (let i = 0; i < 3; i += 1) { continue; }", "for (let i = 0; (i < 3); (i += 1)) { continue; }"},
+		{"for (i = 0; i < 3; i += 1) { }", "for ((i = 0); (i < 3); (i += 1)) {  }"},
+		{"for (;;) { break; }", "for (; ; ) { break; }"},
+		{"for (x in [1, 2]) { puts(x); }", "for (x in [1, 2]) { puts(x) }"},
+		{"for (c in \"abc\") { break; }", "for (c in abc) { break; }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("input %q - program.Statements does not contain 1 statement. got=%d",
+				tt.input, len(program.Statements))
+		}
+
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("input %q - wrong statement. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	input := `for (x in items) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ForInStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+
+	if !testIdentifier(t, stmt.Iterable, "items") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Errorf("body is not 1 statement. got=%d", len(stmt.Body.Statements))
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	input := "true;"
 
@@ -660,6 +981,7 @@ func TestFunctionParameterParsing(t *testing.T) {
 		{input: "fn() {};", expectedParams: []string{}},
 		{input: "fn(a) {};", expectedParams: []string{"a"}},
 		{input: "fn(a, b, c) {};", expectedParams: []string{"a", "b", "c"}},
+		{input: "fn(a, ...b) {};", expectedParams: []string{"a"}},
 	}
 
 	for _, tt := range tests {
@@ -682,6 +1004,104 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 10) { a }", "fn(a, b = 10)a"},
+		{"fn(a = 1, b = a * 2) { b }", "fn(a = 1, b = (a * 2))b"},
+		{"fn(head, ...tail) { tail }", "fn(head, ...tail)tail"},
+		{"fn(...all) { all }", "fn(...all)all"},
+		{"fn(x, y = [1, 2], ...z) { x }", "fn(x, y = [1, 2], ...z)x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := program.Statements[0].String(); got != tt.expected {
+			t.Errorf("input %q - wrong function. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	l := lexer.New("fn(a, b = 10, ...c) { a }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+	if function.Default(0) != nil {
+		t.Errorf("parameter without a default has one. got=%s", function.Default(0))
+	}
+
+	testLiteralExpression(t, function.Default(1), 10)
+
+	if function.Rest == nil || function.Rest.Value != "c" {
+		t.Errorf("rest parameter wrong. got=%v", function.Rest)
+	}
+}
+
+func TestSpreadArguments(t *testing.T) {
+	input := "add(1, ...xs, ...[2, 3])"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	if len(call.Arguments) != 3 {
+		t.Fatalf("wrong number of arguments. want=3, got=%d", len(call.Arguments))
+	}
+
+	testLiteralExpression(t, call.Arguments[0], 1)
+
+	spread, ok := call.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument is not ast.SpreadExpression. got=%T", call.Arguments[1])
+	}
+
+	testIdentifier(t, spread.Value, "xs")
+
+	if call.String() != "add(1, ...xs, ...[2, 3])" {
+		t.Errorf("wrong String. got=%q", call.String())
+	}
+}
+
+func TestNamedArguments(t *testing.T) {
+	input := "f(1, sep: \"-\", count: x + 1)"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	if len(call.Arguments) != 3 {
+		t.Fatalf("wrong number of arguments. want=3, got=%d", len(call.Arguments))
+	}
+
+	testLiteralExpression(t, call.Arguments[0], 1)
+
+	named, ok := call.Arguments[2].(*ast.NamedArgument)
+	if !ok {
+		t.Fatalf("argument is not ast.NamedArgument. got=%T", call.Arguments[2])
+	}
+
+	testIdentifier(t, named.Name, "count")
+	testInfixExpression(t, named.Value, "x", "+", 1)
+
+	if call.String() != "f(1, sep: -, count: (x + 1))" {
+		t.Errorf("wrong String. got=%q", call.String())
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -914,3 +1334,187 @@ func TestFunctionLiteralWithName(t *testing.T) {
 		t.Fatalf("function literal name wrong. want. 'myFunc', got=%q\n", function.Name)
 	}
 }
+
+func TestNodeSpans(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y;
+};
+add(1, [2, 3][0]);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	letStmt := program.Statements[0].(*ast.LetStatement)
+	fn := letStmt.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	index := call.Arguments[1].(*ast.IndexExpression)
+
+	tests := []struct {
+		node      ast.Node
+		startLine int
+		startCol  int
+		endLine   int
+		endCol    int
+	}{
+		{program, 1, 1, 4, 18},
+		{letStmt, 1, 1, 3, 2},
+		{fn, 1, 11, 3, 2},
+		{fn.Body, 1, 20, 3, 2},
+		{body.Expression, 2, 3, 2, 8},
+		{call, 4, 1, 4, 18},
+		{index, 4, 8, 4, 17},
+		{index.Left, 4, 8, 4, 14},
+	}
+
+	for i, tt := range tests {
+		pos, end := tt.node.Pos(), tt.node.End()
+
+		if pos.Line != tt.startLine || pos.Column != tt.startCol {
+			t.Errorf("tests[%d] - %T start wrong. want=%d:%d, got=%s", i, tt.node, tt.startLine, tt.startCol, pos)
+		}
+
+		if end.Line != tt.endLine || end.Column != tt.endCol {
+			t.Errorf("tests[%d] - %T end wrong. want=%d:%d, got=%s", i, tt.node, tt.endLine, tt.endCol, end)
+		}
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedCode    diagnostic.Code
+		expectedMessage string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let x 5;", diagnostic.UnexpectedToken, "expected next token to be =, got INT instead", 1, 7},
+		{"let x = (1;", diagnostic.UnexpectedToken, "expected next token to be ), got ; instead", 1, 11},
+		{"let x = ;", diagnostic.MissingExpression, "no prefix parse function for ; found", 1, 9},
+		{"1 +\n  @", diagnostic.IllegalCharacter, "illegal character '@'", 2, 3},
+		{`"abc`, diagnostic.UnterminatedString, "string literal not terminated", 1, 1},
+		{"09", diagnostic.InvalidInteger, `could not parse "09" as integer`, 1, 1},
+		{"let x = 0x;", diagnostic.InvalidNumber, "hexadecimal literal 0x has no digits", 1, 9},
+		{"fn() { 1", diagnostic.UnexpectedToken, "expected next token to be }, got EOF instead", 1, 9},
+		{"1 + /* open\n", diagnostic.UnterminatedComment, "block comment not terminated", 1, 5},
+		{`let s = "a\qb";`, diagnostic.InvalidEscape, `unknown escape sequence \q`, 1, 11},
+		{`"a ${} b"`, diagnostic.MissingExpression, "expected an expression inside ${}", 1, 6},
+		{`"a ${x y} b"`, diagnostic.UnexpectedToken, "expected } to close the interpolation, got IDENT instead", 1, 8},
+		{"1 = 2;", diagnostic.InvalidAssignment, "invalid assignment target", 1, 1},
+		{"let a = 1;\na + b += 3;", diagnostic.InvalidAssignment, "invalid assignment target", 2, 1},
+		{"f() = 1;", diagnostic.InvalidAssignment, "invalid assignment target", 1, 1},
+		{"-) = 1", diagnostic.MissingExpression, "no prefix parse function for ) found", 1, 2},
+		{"(1 +) = 2", diagnostic.MissingExpression, "no prefix parse function for ) found", 1, 5},
+		{"x + ] = 1", diagnostic.MissingExpression, "no prefix parse function for ] found", 1, 5},
+		{"x = += 1", diagnostic.MissingExpression, "no prefix parse function for += found", 1, 5},
+		{"f = ... = ;", diagnostic.MissingExpression, "no prefix parse function for ... found", 1, 5},
+		{"1 ( ] ) += ", diagnostic.MissingExpression, "no prefix parse function for ] found", 1, 5},
+		{"break;", diagnostic.MisplacedLoopControl, "break outside of a loop", 1, 1},
+		{"if (x) { continue; }", diagnostic.MisplacedLoopControl, "continue outside of a loop", 1, 10},
+		{"while (x) { fn() { break; } }", diagnostic.MisplacedLoopControl, "break outside of a loop", 1, 20},
+		{"while (x) { fn(a = if (x) { break; }) { } }", diagnostic.MisplacedLoopControl, "break outside of a loop", 1, 29},
+		{"for (x in) { }", diagnostic.MissingExpression, "no prefix parse function for ) found", 1, 10},
+		{"let [a, 1] = b;", diagnostic.UnexpectedToken, "expected a name or a pattern, got INT instead", 1, 9},
+		{"let [...a, b] = c;", diagnostic.UnexpectedToken, "expected next token to be ], got , instead", 1, 10},
+		{"let {a: b.c} = d;", diagnostic.IllegalCharacter, "illegal character '.'", 1, 10},
+		{"let {\"a\": b} = c;", diagnostic.UnexpectedToken, "expected next token to be IDENT, got STRING instead", 1, 6},
+		{"fn(a = 1, b) { }", diagnostic.InvalidParameter, "parameter b without a default follows one with a default", 1, 11},
+		{"fn(...a, b) { }", diagnostic.UnexpectedToken, "expected next token to be ), got , instead", 1, 8},
+		{"[...a]", diagnostic.MissingExpression, "no prefix parse function for ... found", 1, 2},
+		{"f(a: 1, 2)", diagnostic.InvalidArgument, "positional argument follows a named argument", 1, 9},
+		{"f(a: 1, ...b)", diagnostic.InvalidArgument, "positional argument follows a named argument", 1, 9},
+		{"f(a: 1, a: 2)", diagnostic.InvalidArgument, "argument a passed more than once", 1, 9},
+		{"f(a: )", diagnostic.MissingExpression, "no prefix parse function for ) found", 1, 6},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("input %q - expected parser errors, got none", tt.input)
+		}
+
+		d := errors[0]
+		if d.Severity != diagnostic.Error {
+			t.Errorf("input %q - wrong severity. got=%s", tt.input, d.Severity)
+		}
+		if d.Code != tt.expectedCode {
+			t.Errorf("input %q - wrong code. want=%s, got=%s", tt.input, tt.expectedCode, d.Code)
+		}
+		if d.Message != tt.expectedMessage {
+			t.Errorf("input %q - wrong message. want=%q, got=%q", tt.input, tt.expectedMessage, d.Message)
+		}
+		if d.Span.Start.Line != tt.expectedLine || d.Span.Start.Column != tt.expectedColumn {
+			t.Errorf("input %q - wrong position. want=%d:%d, got=%s",
+				tt.input, tt.expectedLine, tt.expectedColumn, d.Span.Start)
+		}
+	}
+}
+
+func TestParsingWithComments(t *testing.T) {
+	input := `// add two numbers
+let add = fn(a, /* the second */ b) {
+  a + b // sum
+};
+/* call it
+   /* nested */ */
+add(1, 2);`
+
+	for _, mode := range []lexer.Mode{0, lexer.ScanComments} {
+		p := New(lexer.NewWithMode("", input, mode))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		expected := "let add = fn<add>(a, b)(a + b);add(1, 2)"
+		if program.String() != expected {
+			t.Errorf("mode %d - wrong program. want=%q, got=%q", mode, expected, program.String())
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	input := `"Hello ${name}, you are ${age + 1}!"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+
+	if len(str.Parts) != 5 {
+		t.Fatalf("wrong number of parts. want=5, got=%d", len(str.Parts))
+	}
+
+	segments := map[int]string{0: "Hello ", 2: ", you are ", 4: "!"}
+	for i, expected := range segments {
+		literal, ok := str.Parts[i].(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("part %d not *ast.StringLiteral. got=%T", i, str.Parts[i])
+		}
+
+		if literal.Value != expected {
+			t.Errorf("part %d wrong. want=%q, got=%q", i, expected, literal.Value)
+		}
+	}
+
+	testIdentifier(t, str.Parts[1], "name")
+	testInfixExpression(t, str.Parts[3], "age", "+", 1)
+
+	if str.String() != "Hello ${name}, you are ${(age + 1)}!" {
+		t.Errorf("str.String() wrong. got=%q", str.String())
+	}
+
+	if str.End().Offset != len(input) {
+		t.Errorf("str.End() wrong. want offset %d, got=%d", len(input), str.End().Offset)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/ioanzicu/monkeyd/compiler"
+	"github.com/ioanzicu/monkeyd/diagnostic"
 	"github.com/ioanzicu/monkeyd/lexer"
 	"github.com/ioanzicu/monkeyd/object"
 	"github.com/ioanzicu/monkeyd/parser"
@@ -50,14 +51,15 @@ func Start(in io.Reader, out io.Writer) {
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, line, p.Errors())
 			continue
 		}
 
 		comp := compiler.NewWithState(symbolTable, constants)
 		err := comp.Compile(program)
 		if err != nil {
-			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
+			io.WriteString(out, "Woops! Compilation failed:\n")
+			vm.FprintError(out, "", line, err)
 			continue
 		}
 
@@ -67,11 +69,18 @@ func Start(in io.Reader, out io.Writer) {
 		machine := vm.NewWithGlobalsStore(code, globals)
 		err = machine.Run()
 		if err != nil {
-			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
+			io.WriteString(out, "Woops! Executing bytecode failed:\n")
+			vm.FprintError(out, "", line, err)
 			continue
 		}
 
+		// a line of declarations that compile to nothing,
+		// like an inlined const, leaves no value to print
 		lastPopped := machine.LastPoppedStackElem()
+		if lastPopped == nil {
+			continue
+		}
+
 		io.WriteString(out, lastPopped.Inspect())
 		io.WriteString(out, "\n")
 	}
@@ -90,11 +99,9 @@ const MONKEY_FACE = `
               '-----'
 `
 
-func printParserErrors(out io.Writer, errors []string) {
+func printParserErrors(out io.Writer, source string, errors diagnostic.List) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
-	}
+	diagnostic.FprintAll(out, source, errors)
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ioanzicu/monkeyd/ast"
+	"github.com/ioanzicu/monkeyd/compiler"
+	"github.com/ioanzicu/monkeyd/diagnostic"
+	"github.com/ioanzicu/monkeyd/evaluator"
+	"github.com/ioanzicu/monkeyd/lexer"
+	"github.com/ioanzicu/monkeyd/object"
+	"github.com/ioanzicu/monkeyd/parser"
+	"github.com/ioanzicu/monkeyd/vm"
+)
+
+// Exit statuses of the monkeyd commands
+const (
+	exitOK    = 0
+	exitError = 1 // the script failed to parse, compile or run
+	exitUsage = 2 // the command line was invalid
+)
+
+// scriptArgsName - global variable holding the script arguments,
+// always defined first so compiled files find it at scriptArgsIndex
+const (
+	scriptArgsName  = "args"
+	scriptArgsIndex = 0
+)
+
+// runCommand - monkeyd run [--engine=vm|eval] <file> [args...]
+func runCommand(arguments []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	engine := flags.String("engine", "vm", "use 'vm' or 'eval'")
+
+	if err := flags.Parse(arguments); err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() < 1 {
+		fmt.Fprintf(os.Stderr, "monkeyd run: missing script file\n\n%s", usage)
+		return exitUsage
+	}
+
+	if *engine != "vm" && *engine != "eval" {
+		fmt.Fprintf(os.Stderr, "monkeyd run: unknown engine %q, use 'vm' or 'eval'\n", *engine)
+		return exitUsage
+	}
+
+	filename := flags.Arg(0)
+	scriptArgs := newArgsArray(flags.Args()[1:])
+
+	source, program, ok := parseFile(os.Stderr, filename)
+	if !ok {
+		return exitError
+	}
+
+	if *engine == "eval" {
+		return runEvaluator(os.Stderr, source, program, scriptArgs)
+	}
+
+	return runVM(os.Stderr, filename, source, program, scriptArgs)
+}
+
+// parseFile - read and parse the file, diagnostics go to errOut
+func parseFile(errOut io.Writer, filename string) (string, *ast.Program, bool) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(errOut, "monkeyd: %s\n", err)
+		return "", nil, false
+	}
+
+	source := string(content)
+
+	p := parser.New(lexer.NewWithFilename(filename, source))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		diagnostic.FprintAll(errOut, source, p.Errors())
+		return source, nil, false
+	}
+
+	return source, program, true
+}
+
+func runVM(errOut io.Writer, filename, source string, program *ast.Program, scriptArgs *object.Array) int {
+	bytecode, err := compileProgram(program)
+	if err != nil {
+		vm.FprintError(errOut, filename, source, err)
+		return exitError
+	}
+
+	return runBytecode(errOut, filename, source, bytecode, scriptArgs)
+}
+
+// compileProgram - compile with the script arguments
+// predefined as the first global
+func compileProgram(program *ast.Program) (*compiler.Bytecode, error) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	symbolTable.Define(scriptArgsName)
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	return comp.Bytecode(), nil
+}
+
+// runBytecode - filename and source are those the bytecode was
+// compiled from, empty when they are not known
+func runBytecode(errOut io.Writer, filename, source string, bytecode *compiler.Bytecode, scriptArgs *object.Array) int {
+	globals := make([]object.Object, vm.GlobalsSize)
+	globals[scriptArgsIndex] = scriptArgs
+
+	machine := vm.NewWithGlobalsStore(bytecode, globals)
+	if err := machine.Run(); err != nil {
+		vm.FprintError(errOut, filename, source, err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+func runEvaluator(errOut io.Writer, source string, program *ast.Program, scriptArgs *object.Array) int {
+	env := object.NewEnvironment()
+	env.Set(scriptArgsName, scriptArgs)
+
+	result := evaluator.Eval(program, env)
+	if errObj, ok := result.(*object.Error); ok {
+		span := diagnostic.Span{Start: errObj.Pos, End: errObj.Pos}
+		diagnostic.Fprint(errOut, source, diagnostic.Errorf(diagnostic.RuntimeFailure, span, "%s", errObj.Message))
+		return exitError
+	}
+
+	return exitOK
+}
+
+func newArgsArray(arguments []string) *object.Array {
+	elements := make([]object.Object, len(arguments))
+	for i, arg := range arguments {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,41 @@
+package token
+
+import "fmt"
+
+// Position - a location in the source text
+type Position struct {
+	Filename string
+	Offset   int // byte offset, starting at 0
+	Line     int // line number, starting at 1
+	Column   int // column number, starting at 1 (code point count)
+}
+
+// IsValid - reports whether the position was set by the lexer
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String - returns file:line:column, line:column or "-". A position
+// without a column is file:line, or "line N" without a file name
+func (p Position) String() string {
+	s := p.Filename
+
+	if p.IsValid() {
+		switch {
+		case p.Column > 0 && s != "":
+			s += fmt.Sprintf(":%d:%d", p.Line, p.Column)
+		case p.Column > 0:
+			s = fmt.Sprintf("%d:%d", p.Line, p.Column)
+		case s != "":
+			s += fmt.Sprintf(":%d", p.Line)
+		default:
+			s = fmt.Sprintf("line %d", p.Line)
+		}
+	}
+
+	if s == "" {
+		s = "-"
+	}
+
+	return s
+}
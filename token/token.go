@@ -3,12 +3,20 @@ package token
 const (
 	ILLEGAL = "ILLEGAL" // token not supported
 	EOF     = "EOF"     // End Of File
+	COMMENT = "COMMENT" // only emitted when the lexer is asked for comments
 
 	// Identifiers + literals
 	IDENT  = "IDENT" // add, foobar, x, y ...
 	INT    = "INT"   // 123456789
+	FLOAT  = "FLOAT" // 3.14, 1e-9
 	STRING = "STRING"
 
+	// Interpolated string "a ${x} b ${y} c" is split into
+	// STRING_HEAD "a ", x, STRING_MID " b ", y, STRING_TAIL " c"
+	STRING_HEAD = "STRING_HEAD"
+	STRING_MID  = "STRING_MID"
+	STRING_TAIL = "STRING_TAIL"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -16,17 +24,38 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+
+	// Compound assignment
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
+	// Bitwise
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..." // the rest of a pattern
 
 	LPAREN = "("
 	RPAREN = ")"
@@ -47,6 +76,12 @@ const (
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	CONST    = "CONST"
 )
 
 type TokenType string
@@ -55,16 +90,25 @@ type Token struct {
 	Type    TokenType
 	Literal string
 	Error   error
+
+	Pos Position // position of the first character of the token
+	End Position // position immediately after the token
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"if":       IF,
+	"else":     ELSE,
+	"true":     TRUE,
+	"false":    FALSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"const":    CONST,
 }
 
 func LookupIdent(ident string) TokenType {
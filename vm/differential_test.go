@@ -0,0 +1,364 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/ioanzicu/monkeyd/compiler"
+	"github.com/ioanzicu/monkeyd/evaluator"
+	"github.com/ioanzicu/monkeyd/object"
+)
+
+// runBothEngines - result of the program in the evaluator and the VM,
+// a failure is reported as its message and source line
+func runBothEngines(t *testing.T, input string) (evalResult, vmResult engineResult) {
+	t.Helper()
+
+	evaluated := evaluator.Eval(parse(input), object.NewEnvironment())
+	if errObj, ok := evaluated.(*object.Error); ok {
+		evalResult = engineResult{err: errObj.Message, line: errObj.Pos.Line}
+	} else {
+		evalResult = engineResult{value: evaluated.Inspect()}
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		rtErr, ok := err.(*RuntimeError)
+		if !ok {
+			t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+		}
+		vmResult = engineResult{err: rtErr.Message, line: rtErr.Trace[0].Line}
+	} else {
+		vmResult = engineResult{value: machine.LastPoppedStackElem().Inspect()}
+	}
+
+	return evalResult, vmResult
+}
+
+type engineResult struct {
+	value string
+	err   string
+	line  int
+}
+
+func TestEnginesAgreeOnArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{"7 / 2", engineResult{value: "3"}},
+		{"-7 / 2", engineResult{value: "-3"}},
+		{"10 / 0", engineResult{err: "division by zero", line: 1}},
+		{"1 & 1.0", engineResult{err: "unknown operator: INTEGER & FLOAT", line: 1}},
+		{"let f = 1.5;\nf << 2", engineResult{err: "unknown operator: FLOAT << INTEGER", line: 2}},
+		{"\"a\" < \"b\"", engineResult{err: "unknown operator: STRING < STRING", line: 1}},
+		{"\"a\" - \"b\"", engineResult{err: "unknown operator: STRING - STRING", line: 1}},
+		{"[1] >= [2]", engineResult{err: "unknown operator: ARRAY >= ARRAY", line: 1}},
+		{"true + false", engineResult{err: "unknown operator: BOOLEAN + BOOLEAN", line: 1}},
+		{"1 < \"a\"", engineResult{err: "type mismatch: INTEGER < STRING", line: 1}},
+		{"let x = 1;\nx += true", engineResult{err: "type mismatch: INTEGER + BOOLEAN", line: 2}},
+		{"-\"a\"", engineResult{err: "unknown operator: -STRING", line: 1}},
+		{"let zero = 0;\n5 * (10 / zero)", engineResult{err: "division by zero", line: 2}},
+		{
+			"let div = fn(a, b) {\n  a / b\n};\nlet run = fn() { div(1, 0) };\nrun()",
+			engineResult{err: "division by zero", line: 2},
+		},
+		{"0 / 5", engineResult{value: "0"}},
+		{"9223372036854775807 + 1", engineResult{value: "9223372036854775808"}},
+		{"-9223372036854775807 - 2", engineResult{value: "-9223372036854775809"}},
+		{"4611686018427387904 * 2", engineResult{value: "9223372036854775808"}},
+		{"(-9223372036854775807 - 1) / -1", engineResult{value: "9223372036854775808"}},
+		{"-(-9223372036854775807 - 1)", engineResult{value: "9223372036854775808"}},
+		{"99999999999999999999 / 0", engineResult{err: "division by zero", line: 1}},
+		{"99999999999999999999 > 9223372036854775807", engineResult{value: "true"}},
+		{"-99999999999999999999 < 1", engineResult{value: "true"}},
+		{"99999999999999999999 == 99999999999999999999", engineResult{value: "true"}},
+		{"99999999999999999999 + 0.5", engineResult{value: "1e+20"}},
+		{
+			"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };\nfact(25)",
+			engineResult{value: "15511210043330985984000000"},
+		},
+		{"0xFF + 0o17 + 0b11", engineResult{value: "273"}},
+		{"1_000_000 * 1_000", engineResult{value: "1000000000"}},
+		{"0xFFFF_FFFF_FFFF_FFFF_FFFF", engineResult{value: "1208925819614629174706175"}},
+		{"7 % 3", engineResult{value: "1"}},
+		{"-7 % 3", engineResult{value: "-1"}},
+		{"7 % -3", engineResult{value: "1"}},
+		{"(-7 / 3) * 3 + -7 % 3", engineResult{value: "-7"}},
+		{"(-9223372036854775807 - 1) % -1", engineResult{value: "0"}},
+		{"-99999999999999999999 % 7", engineResult{value: "-1"}},
+		{"-7.5 % 2", engineResult{value: "-1.5"}},
+		{"5 % 0", engineResult{err: "modulo by zero", line: 1}},
+		{"3 <= 3.0 && 3.0 >= 3", engineResult{value: "true"}},
+		{"0b1100 & 0b1010", engineResult{value: "8"}},
+		{"0b1100 | 0b1010", engineResult{value: "14"}},
+		{"0b1100 ^ 0b1010", engineResult{value: "6"}},
+		{"~0", engineResult{value: "-1"}},
+		{"~-1", engineResult{value: "0"}},
+		{"-8 & 0xFF", engineResult{value: "248"}},
+		{"1 << 10", engineResult{value: "1024"}},
+		{"1 << 63", engineResult{value: "9223372036854775808"}},
+		{"-1 << 63", engineResult{value: "-9223372036854775808"}},
+		{"(1 << 63) >> 63", engineResult{value: "1"}},
+		{"-16 >> 2", engineResult{value: "-4"}},
+		{"-1 >> 63", engineResult{value: "-1"}},
+		{"~((1 << 63) * 2)", engineResult{value: "-18446744073709551617"}},
+		{"(1 << 63 | 1 << 62) ^ (1 << 63)", engineResult{value: "4611686018427387904"}},
+		{"1 << 64", engineResult{err: "shift count too large: 64", line: 1}},
+		{"1 >> -1", engineResult{err: "negative shift count: -1", line: 1}},
+		{"let n = 70;\n1 << n", engineResult{err: "shift count too large: 70", line: 2}},
+		{"~true", engineResult{err: "unknown operator: ~BOOLEAN", line: 1}},
+		{"7 / 2.0", engineResult{value: "3.5"}},
+		{`"Ångström"[0] + "Ångström"[7]`, engineResult{value: "Åm"}},
+		{`slice("Ångström", 1, 4)`, engineResult{value: "ngs"}},
+		{"1 / 0.0", engineResult{value: "+Inf"}},
+		{"-1 / 0.0", engineResult{value: "-Inf"}},
+		{"0.0 / 0.0", engineResult{value: "NaN"}},
+		{"2.0 * 3", engineResult{value: "6.0"}},
+		{"1e21 * 10", engineResult{value: "1e+22"}},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestEnginesAgreeOnEvaluationOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{
+			"let log = [];\nlet f = fn(v) { log[len(log)] = v; v };\nf(1) <= f(2); f(3) < f(4); f(5) > f(6); f(7) >= f(8);\nlog",
+			engineResult{value: "[1, 2, 3, 4, 5, 6, 7, 8]"},
+		},
+		{"let x = 0;\n(x += 1) <= (x *= 10);\nx", engineResult{value: "10"}},
+		{"let x = 1;\n(x *= 10) < (x += 1)", engineResult{value: "true"}},
+		{"let x = 2;\n[x = 5, x < 3, x <= 5]", engineResult{value: "[5, false, true]"}},
+		{"0.0 / 0.0 < 1 || 0.0 / 0.0 <= 1", engineResult{value: "false"}},
+		{"let f = fn() { 1 / 0 };\nf() < 1 % 0", engineResult{err: "division by zero", line: 1}},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestEnginesAgreeOnAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{"let x = 9223372036854775807;\nx += 1", engineResult{value: "9223372036854775808"}},
+		{"let s = \"Å\";\ns += s", engineResult{value: "ÅÅ"}},
+		{"let x = 1;\nx /= 0", engineResult{err: "division by zero", line: 2}},
+		{"let x = 3;\nx /= 2.0", engineResult{value: "1.5"}},
+		{
+			"let acc = fn() {\n  let total = 0;\n  fn(n) { total += n }\n};\nlet add = acc();\nadd(1); add(2); add(3)",
+			engineResult{value: "6"},
+		},
+		{
+			"let x = 1;\nlet f = fn() { let x = 2; x = 3 };\nf() * 10 + x",
+			engineResult{value: "31"},
+		},
+		{"let a = [1, 2];\na[2] = 3;\na", engineResult{value: "[1, 2, 3]"}},
+		{"let a = [[1], [2]];\na[1][0] += 40;\na", engineResult{value: "[[1], [42]]"}},
+		{"let h = {};\nh[1.0] = \"one\";\nh[1]", engineResult{value: "one"}},
+		{"let a = [1, 2];\na[5] = 0", engineResult{err: "index out of range: 5 with length 2", line: 2}},
+		{"let h = {};\nh[[1]] = 0", engineResult{err: "unusable as hash key: ARRAY", line: 2}},
+		{"let f = fn() { f = 1 };\nf();\nf", engineResult{value: "1"}},
+		{"let f = fn() { f = 1; f };\nf()", engineResult{value: "1"}},
+		{"let f = fn() { let g = fn() { f += 1 }; f = 1; g(); f };\nf()", engineResult{value: "2"}},
+		{"let outer = fn() {\n  let f = fn() { f = 2 };\n  f();\n  f\n};\nouter()", engineResult{value: "2"}},
+		{
+			"let fs = [];\nfor (i in [1, 2]) { let f = fn() { f = i }; fs[len(fs)] = f; f(); }\n[fs[0](), fs[1]()]",
+			engineResult{value: "[1, 2]"},
+		},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestEnginesAgreeOnLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{"let n = 0;\nwhile (n < 4) { n += 1; }\nn", engineResult{value: "4"}},
+		{"let s = \"\";\nfor (c in \"Åb\") { s += c + \"-\"; }\ns", engineResult{value: "Å-b-"}},
+		{"let s = 0;\nfor (let i = 0; i < 10; i += 1) {\n  if (i == 5) { break; }\n  s += i;\n}\ns", engineResult{value: "10"}},
+		{
+			"let fns = [];\nfor (x in [1, 2]) {\n  fns = push(fns, fn() { x });\n}\nfns[0]() + fns[1]() * 10",
+			engineResult{value: "21"},
+		},
+		{"for (x in 5) { }", engineResult{err: "cannot iterate over INTEGER", line: 1}},
+		{"let i = 0;\nwhile (true) {\n  i += 1;\n  if (i > 2) { i / 0 }\n}", engineResult{err: "division by zero", line: 4}},
+		{"if (false) { 1 }", engineResult{value: "null"}},
+		{"let f = fn() { let a = 1; };\nf()", engineResult{value: "null"}},
+		{"let i = 0;\nwhile (i < 5000) { i += 1; let x = [1, 2, if (true) { continue; }]; }\ni", engineResult{value: "5000"}},
+		{
+			"let i = 0;\nlet seen = [];\nwhile (i < 3) {\n  i += 1;\n  let x = if (i == 2) { continue; } else { i };\n  seen = push(seen, x);\n}\nseen",
+			engineResult{value: "[1, 3]"},
+		},
+		{"let out = [];\nlet i = 0;\nwhile (true) { i += 1; out = push(out, if (i == 3) { break; } else { i }); }\nout", engineResult{value: "[1, 2]"}},
+		{"let s = 0;\nfor (x in [1, 2, 3, 4]) { s += x * if (x == 3) { continue; } else { 1 }; }\ns", engineResult{value: "7"}},
+		{
+			"let r = [];\nfor (x in [1, 2]) {\n  r = push(r, if (true) { let n = 0; while (true) { n += 1; if (n == x) { break; } }; n });\n}\nr",
+			engineResult{value: "[1, 2]"},
+		},
+		{"let n = 0;\nwhile (n < 3) { n += 1; let t = n > 1 && if (true) { break; }; }\nn", engineResult{value: "2"}},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestEnginesAgreeOnBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{"let x = 1;\nif (true) { let x = x + 1; x } * 10 + x", engineResult{value: "21"}},
+		{"let x = \"a\";\nif (true) { x += \"b\"; let x = 0; };\nx", engineResult{value: "ab"}},
+		{
+			"let f = fn() {\n  let g = if (true) { let a = 1; fn() { a += 1 } };\n  let b = 10;\n  g() + g() + b\n};\nf()",
+			engineResult{value: "15"},
+		},
+		{"if (true) {\n  let z = 0;\n  1 / z\n}", engineResult{err: "division by zero", line: 3}},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestEnginesAgreeOnConsts(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{"const big = 99999999999999999999;\nconst neg = -9223372036854775808;\nbig + neg", engineResult{value: "90776627963145224191"}},
+		{"const greeting = \"hi\";\nlet f = fn(name) { greeting + \" \" + name };\nf(\"you\")", engineResult{value: "hi you"}},
+		{"const xs = [];\nfor (x in [1, 2]) { xs[len(xs)] = x * 2; };\nxs", engineResult{value: "[2, 4]"}},
+		{"const zero = 0;\n1 / zero", engineResult{err: "division by zero", line: 2}},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestEnginesAgreeOnDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{"let [a, ...r] = \"héllo\";\n[a, r]", engineResult{value: "[h, éllo]"}},
+		{"let [x, y] = {\"x\": 1};\n[x, y]", engineResult{value: "[null, null]"}},
+		{"let {a, b: [c, ...d]} = {\"a\": 1, \"b\": [2, 3, 4]};\n[a, c, d]", engineResult{value: "[1, 2, [3, 4]]"}},
+		{"let [a] = 5;", engineResult{err: "index operator not supported: INTEGER", line: 1}},
+		{"let {a} = [1];", engineResult{err: "index operator not supported: ARRAY", line: 1}},
+		{"let pair = {};\nlet [first, ...others] = pair;", engineResult{err: "rest pattern not supported: HASH", line: 2}},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
+
+func TestEnginesAgreeOnParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected engineResult
+	}{
+		{"let greet = fn(name, greeting = \"hi\") { greeting + \" \" + name };\n[greet(\"a\"), greet(\"b\", \"yo\")]", engineResult{value: "[hi a, yo b]"}},
+		{"let f = fn(a = b, b = a) { [a, b] };\n[f(), f(1), f(1, 2)]", engineResult{value: "[[null, null], [1, 1], [1, 2]]"}},
+		{"let sum = fn(...xs) { let s = 0; for (x in xs) { s += x; }; s };\nsum(1, ...[2, 3], ...[], 4)", engineResult{value: "10"}},
+		{"let f = fn(a, b = 1) { a };\nf(1, 2, 3)", engineResult{err: "wrong number of arguments: want=1 to 2, got=3", line: 2}},
+		{"let f = fn(a, b) { a };\nf(...\"ab\")", engineResult{err: "spread argument must be ARRAY, got STRING", line: 2}},
+		{"let f = fn(a,\n  b = a / 0) { b };\nf(1)", engineResult{err: "division by zero", line: 2}},
+		{"let f = fn(a, b = 2, c = 3) { [a, b, c] };\n[f(1, c: 5), f(c: 6, a: 0)]", engineResult{value: "[[1, 2, 5], [0, 2, 6]]"}},
+		{"let f = fn(a, b = a * 2, c = b + 1) { [a, b, c] };\nf(1, c: 0)", engineResult{value: "[1, 2, 0]"}},
+		{"let f = fn(a = 1, ...rest) { [a, rest] };\n[f(a: 5), f(...[1, 2], ...[3])]", engineResult{value: "[[5, []], [1, [2, 3]]]"}},
+		{"let f = fn(a, b) { a };\nf(1, c: 2)", engineResult{err: "unknown parameter c", line: 2}},
+		{"let f = fn(a, b) { a };\nf(1, a: 2)", engineResult{err: "parameter a already has an argument", line: 2}},
+		{"let f = fn(a, b = 1) { a };\nf(b: 2)", engineResult{err: "missing argument for parameter a", line: 2}},
+		{"let f = fn(a) { a };\nf(a:\n  1 / 0)", engineResult{err: "division by zero", line: 3}},
+		{"len(a: \"ab\")", engineResult{err: "BUILTIN does not take named arguments", line: 1}},
+	}
+
+	for _, tt := range tests {
+		evalResult, vmResult := runBothEngines(t, tt.input)
+
+		if evalResult != tt.expected {
+			t.Errorf("evaluator result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, evalResult)
+		}
+
+		if vmResult != tt.expected {
+			t.Errorf("vm result wrong for %q. want=%+v, got=%+v", tt.input, tt.expected, vmResult)
+		}
+	}
+}
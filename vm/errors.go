@@ -0,0 +1,167 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ioanzicu/monkeyd/code"
+	"github.com/ioanzicu/monkeyd/diagnostic"
+	"github.com/ioanzicu/monkeyd/token"
+)
+
+// StackFrame - a call that was active when the runtime error occurred
+type StackFrame struct {
+	Function string // function name, "<main>" or "<anonymous>"
+	Offset   int    // offset of the executing instruction
+	Line     int    // source line of the instruction, 0 if unknown
+}
+
+func (sf StackFrame) String() string {
+	if sf.Line == 0 {
+		return fmt.Sprintf("at %s (offset %04d)", sf.Function, sf.Offset)
+	}
+
+	return fmt.Sprintf("at %s (line %d, offset %04d)", sf.Function, sf.Line, sf.Offset)
+}
+
+var (
+	// ErrCanceled - the context passed to RunContext was canceled
+	ErrCanceled = errors.New("execution canceled")
+
+	// ErrDeadlineExceeded - the deadline of the context passed to RunContext expired
+	ErrDeadlineExceeded = errors.New("execution deadline exceeded")
+)
+
+// RuntimeError - failure while executing the bytecode, with the
+// Monkey-level call stack at the moment of the failure
+type RuntimeError struct {
+	Message string
+	Trace   []StackFrame // innermost call first
+	Err     error        // ErrCanceled or ErrDeadlineExceeded when the run was stopped
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// traceEdge - frames kept at each end of a long stack trace
+const traceEdge = 10
+
+// StackTrace - one line per active call, innermost first,
+// the middle of a deep recursion is elided
+func (e *RuntimeError) StackTrace() string {
+	var out strings.Builder
+
+	for i, sf := range e.Trace {
+		if len(e.Trace) > 2*traceEdge && i >= traceEdge && i < len(e.Trace)-traceEdge {
+			if i == traceEdge {
+				fmt.Fprintf(&out, "\t... %d frames omitted\n", len(e.Trace)-2*traceEdge)
+			}
+			continue
+		}
+
+		out.WriteString("\t")
+		out.WriteString(sf.String())
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+// Diagnostic - the error as a diagnostic at the source line of the
+// innermost call in filename, the line table has no columns
+func (e *RuntimeError) Diagnostic(filename string) *diagnostic.Diagnostic {
+	span := diagnostic.Span{}
+
+	for _, sf := range e.Trace {
+		if sf.Line > 0 {
+			span.Start = token.Position{Filename: filename, Line: sf.Line}
+			span.End = span.Start
+			break
+		}
+	}
+
+	return diagnostic.Errorf(diagnostic.RuntimeFailure, span, "%s", e.Message)
+}
+
+// FprintError - render diagnostics with a source excerpt and runtime
+// errors with their stack trace, fall back to the plain message
+func FprintError(w io.Writer, filename, source string, err error) {
+	if rtErr, ok := err.(*RuntimeError); ok {
+		diagnostic.Fprint(w, source, rtErr.Diagnostic(filename))
+		fmt.Fprintf(w, "stack trace:\n%s", rtErr.StackTrace())
+		return
+	}
+
+	if d, ok := err.(*diagnostic.Diagnostic); ok {
+		diagnostic.Fprint(w, source, d)
+		return
+	}
+
+	fmt.Fprintf(w, "error: %s\n", err)
+}
+
+// newError - the stack trace is attached by Run
+func newError(format string, a ...any) error {
+	return &RuntimeError{Message: fmt.Sprintf(format, a...)}
+}
+
+// contextError - the run was stopped by its context
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &RuntimeError{Message: ErrDeadlineExceeded.Error(), Err: ErrDeadlineExceeded}
+	}
+
+	return &RuntimeError{Message: ErrCanceled.Error(), Err: ErrCanceled}
+}
+
+// stackTrace - snapshot of the active frames, innermost first
+func (vm *VM) stackTrace() []StackFrame {
+	trace := make([]StackFrame, 0, vm.framesIndex)
+
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+
+		name := fn.Name
+		if i == 0 {
+			name = "<main>"
+		} else if name == "" {
+			name = "<anonymous>"
+		}
+
+		offset := instructionStart(fn.Instructions, frame.ip)
+
+		trace = append(trace, StackFrame{
+			Function: name,
+			Offset:   offset,
+			Line:     fn.Lines.Line(offset),
+		})
+	}
+
+	return trace
+}
+
+// instructionStart - offset of the instruction the ip is in,
+// the ip may already point at one of its operands
+func instructionStart(ins code.Instructions, ip int) int {
+	start := 0
+
+	for offset := 0; offset < len(ins) && offset <= ip; {
+		start = offset
+
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			break
+		}
+
+		for _, w := range def.OperandWidths {
+			offset += w
+		}
+		offset++
+	}
+
+	return start
+}
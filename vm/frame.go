@@ -11,6 +11,8 @@ type Frame struct {
 	basePointer int // frame pointer - for reference while executing a function
 	// 1. rest button (clean up the stack) - get rid of a just-executed function
 	// 2. serve as a reference for local bindings
+	numArgs int    // arguments passed for the parameters, OpDefault fills in the others
+	passed  []bool // the parameters named arguments passed, nil for a positional call
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -21,6 +23,16 @@ func NewFrame(cl *object.Closure, basePointer int) *Frame {
 	}
 }
 
+// passedArgument - whether the parameter got an argument, named
+// arguments can leave out any parameter with a default
+func (f *Frame) passedArgument(param int) bool {
+	if f.passed != nil {
+		return param < len(f.passed) && f.passed[param]
+	}
+
+	return param < f.numArgs
+}
+
 func (f *Frame) Instructions() code.Instructions {
 	return f.cl.Fn.Instructions
 }
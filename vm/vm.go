@@ -1,7 +1,9 @@
 package vm
 
 import (
-	"fmt"
+	"context"
+	"math"
+	"strings"
 
 	"github.com/ioanzicu/monkeyd/code"
 	"github.com/ioanzicu/monkeyd/compiler"
@@ -155,12 +157,58 @@ import (
 //  			 ----------------------------
 //
 
+// Default limits, see Config
 const (
 	StackSize   = 2048
 	GlobalsSize = 65536
 	MaxFrames   = 1024
 )
 
+// cancelCheckInterval - RunContext looks at its context once
+// per this many instructions, a power of two
+const cancelCheckInterval = 1024
+
+// Config - resource limits of a VM, so untrusted scripts fail
+// with a RuntimeError instead of exhausting the host
+type Config struct {
+	StackSize   int // values on the stack, 0 means StackSize
+	MaxFrames   int // call depth including the main program, 0 means MaxFrames
+	GlobalsSize int // global bindings, 0 means GlobalsSize
+
+	// arrays, hashes, strings and closures created while running,
+	// counted cumulatively, 0 means unlimited
+	MaxHeapObjects int
+
+	// executed instructions, 0 means unlimited
+	InstructionBudget int
+}
+
+// DefaultConfig - the limits used by New
+func DefaultConfig() Config {
+	return Config{
+		StackSize:   StackSize,
+		MaxFrames:   MaxFrames,
+		GlobalsSize: GlobalsSize,
+	}
+}
+
+// withDefaults - replace the unset limits by the defaults
+func (c Config) withDefaults() Config {
+	if c.StackSize <= 0 {
+		c.StackSize = StackSize
+	}
+
+	if c.MaxFrames <= 0 {
+		c.MaxFrames = MaxFrames
+	}
+
+	if c.GlobalsSize <= 0 {
+		c.GlobalsSize = GlobalsSize
+	}
+
+	return c
+}
+
 // Immutable unique values
 // We will compare only the pointers
 // without unwrapping the value the objects are pointing at
@@ -180,29 +228,48 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	config       Config
+	heapObjects  int // objects allocated so far, checked against MaxHeapObjects
+	instructions int // instructions executed so far, checked against InstructionBudget
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	return NewWithConfig(bytecode, DefaultConfig())
+}
+
+// NewWithConfig - like New, with the given resource limits
+func NewWithConfig(bytecode *compiler.Bytecode, config Config) *VM {
+	config = config.withDefaults()
+
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    bytecode.NumLocals,
+		Lines:        bytecode.Lines,
+	}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, config.MaxFrames)
 	frames[0] = mainFrame
 
 	return &VM{
 		constants: bytecode.Constants,
 
-		stack: make([]object.Object, StackSize),
-		sp:    0,
+		stack: make([]object.Object, config.StackSize),
+		sp:    bytecode.NumLocals, // the locals of blocks in the main program
 
-		globals: make([]object.Object, GlobalsSize),
+		globals: make([]object.Object, config.GlobalsSize),
 
 		frames:      frames,
 		framesIndex: 1,
+
+		config: config,
 	}
 }
 
+// NewWithGlobalsStore - like New, the globals are kept in s
+// so they survive between runs, len(s) limits their number
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = s
@@ -216,14 +283,56 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// Run - execute the bytecode, a failure is reported
+// as a *RuntimeError carrying the stack trace
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext - like Run, but stop once ctx is done, the returned
+// error then wraps ErrCanceled or ErrDeadlineExceeded
+func (vm *VM) RunContext(ctx context.Context) error {
+	err := vm.run(ctx)
+
+	if rtErr, ok := err.(*RuntimeError); ok && rtErr.Trace == nil {
+		rtErr.Trace = vm.stackTrace()
+	}
+
+	return err
+}
+
+func (vm *VM) run(ctx context.Context) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
+	// nil for contexts that can never be canceled
+	done := ctx.Done()
+	if done != nil && ctx.Err() != nil {
+		return contextError(ctx.Err())
+	}
+
+	// the locals of the main program are reserved in New
+	if vm.sp > len(vm.stack) {
+		return newError("stack overflow")
+	}
+
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 
+		vm.instructions++
+		if vm.config.InstructionBudget > 0 && vm.instructions > vm.config.InstructionBudget {
+			return newError("instruction budget exceeded")
+		}
+
+		if done != nil && vm.instructions&(cancelCheckInterval-1) == 0 {
+			select {
+			case <-done:
+				return contextError(ctx.Err())
+			default:
+			}
+		}
+
 		// FETCH
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
@@ -246,7 +355,8 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -264,7 +374,8 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual,
+			code.OpLessThan, code.OpLessThanOrEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -285,6 +396,12 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpBitNot:
+			err := vm.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
+
 		case code.OpJump:
 
 			// 1. Decode the operand right after the Opcode
@@ -307,6 +424,15 @@ func (vm *VM) Run() error {
 				vm.currentFrame().ip = pos - 1
 			}
 
+		case code.OpJumpTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -317,13 +443,28 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
+			if int(globalIndex) >= len(vm.globals) {
+				return newError("maximum number of globals exceeded")
+			}
+
 			vm.globals[globalIndex] = vm.pop()
 
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.globals[globalIndex])
+			if int(globalIndex) >= len(vm.globals) {
+				return newError("maximum number of globals exceeded")
+			}
+
+			// a global is unset when its let failed in an earlier
+			// REPL line, or when a bytecode file reads it early
+			global := vm.globals[globalIndex]
+			if global == nil {
+				global = Null
+			}
+
+			err := vm.push(global)
 			if err != nil {
 				return err
 			}
@@ -335,7 +476,7 @@ func (vm *VM) Run() error {
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.sp = vm.sp - numElements
 
-			err := vm.push(array)
+			err := vm.pushAllocated(array)
 			if err != nil {
 				return err
 			}
@@ -350,7 +491,19 @@ func (vm *VM) Run() error {
 			}
 			vm.sp = vm.sp - numElements
 
-			err = vm.push(hash)
+			err = vm.pushAllocated(hash)
+			if err != nil {
+				return err
+			}
+
+		case code.OpConcat:
+			numValues := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := vm.buildString(vm.sp-numValues, vm.sp)
+			vm.sp = vm.sp - numValues
+
+			err := vm.pushAllocated(str)
 			if err != nil {
 				return err
 			}
@@ -364,6 +517,29 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpIndexKeep:
+			index := vm.stack[vm.sp-1]
+			left := vm.stack[vm.sp-2]
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := object.SetIndex(left, index, value); err != nil {
+				return newError("%s", err)
+			}
+
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1 // skip
@@ -373,9 +549,43 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpCallSpread:
+			numArrays := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			err := vm.executeSpreadCall(numArrays)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCallNamed:
+			numArrays := int(code.ReadUint8(ins[ip+1:]))
+			numNamed := int(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.executeNamedCall(numArrays, numNamed)
+			if err != nil {
+				return err
+			}
+
+		case code.OpDefault:
+			param := int(code.ReadUint8(ins[ip+1:]))
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			vm.currentFrame().ip += 3
+
+			if vm.currentFrame().passedArgument(param) {
+				vm.currentFrame().ip = pos - 1
+			}
+
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 
+			// a return in the main program ends it, the value
+			// is left as the last popped element
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1 // instead of vm.pop - get rid of just-executed function on the stack
 
@@ -385,6 +595,10 @@ func (vm *VM) Run() error {
 			}
 
 		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1 // instead of vm.pop - get rid of just-executed function on the stack
 
@@ -398,16 +612,104 @@ func (vm *VM) Run() error {
 			vm.currentFrame().ip += 1
 
 			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
 
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			// a captured local is written through its cell
+			if cell, ok := vm.stack[slot].(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				vm.stack[slot] = vm.pop()
+			}
 
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
 			frame := vm.currentFrame()
+			local := vm.stack[frame.basePointer+int(localIndex)]
+
+			if cell, ok := local.(*object.Cell); ok {
+				local = cell.Value
+			}
+
+			if local == nil {
+				local = Null
+			}
+
+			err := vm.push(local)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+
+			// box the local on its first capture, the slot keeps
+			// the cell so the frame and the closure share it
+			var err error
+			if cell, ok := vm.stack[slot].(*object.Cell); ok {
+				err = vm.push(cell)
+			} else {
+				cell = &object.Cell{Value: vm.stack[slot]}
+				vm.stack[slot] = cell
+				err = vm.pushAllocated(cell)
+			}
+			if err != nil {
+				return err
+			}
+
+		case code.OpClearLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = nil
+
+		case code.OpIter:
+			iterator, err := object.NewIterator(vm.pop())
+			if err != nil {
+				return newError("%s", err)
+			}
+
+			err = vm.pushAllocated(iterator)
+			if err != nil {
+				return err
+			}
+
+		case code.OpRest:
+			start := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			rest, err := object.Rest(vm.pop(), start)
+			if err != nil {
+				return newError("%s", err)
+			}
+
+			err = vm.pushAllocated(rest)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			iterator, ok := vm.pop().(*object.Iterator)
+			if !ok {
+				return newError("not an iterator")
+			}
 
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			next, ok := iterator.Next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+
+			err := vm.push(next)
 			if err != nil {
 				return err
 			}
@@ -437,6 +739,23 @@ func (vm *VM) Run() error {
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex].Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			currentClosure.Free[freeIndex].Value = vm.pop()
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure.Free[freeIndex])
 			if err != nil {
@@ -460,18 +779,24 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
 	if !ok {
-		return fmt.Errorf("not a function: %+v", constant)
+		return newError("not a function: %+v", constant)
 	}
 
-	free := make([]object.Object, numFree)
+	free := make([]*object.Cell, numFree)
 	for i := range numFree {
-		free[i] = vm.stack[vm.sp-numFree+i]
+		switch captured := vm.stack[vm.sp-numFree+i].(type) {
+		case *object.Cell:
+			free[i] = captured
+		default:
+			// the closure being defined, it is never assigned
+			free[i] = &object.Cell{Value: captured}
+		}
 	}
 	// clean up the stack
 	vm.sp = vm.sp - numFree
 
 	closure := &object.Closure{Fn: function, Free: free}
-	return vm.push(closure)
+	return vm.pushAllocated(closure)
 }
 
 func (vm *VM) executeCall(numArgs int) error {
@@ -480,15 +805,100 @@ func (vm *VM) executeCall(numArgs int) error {
 	switch callee := callee.(type) {
 
 	case *object.Closure:
-		return vm.callClosure(callee, numArgs)
+		return vm.callClosure(callee, numArgs, nil)
 
 	case *object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
 
 	default:
-		return fmt.Errorf("calling non-function and non-built-in")
+		return newError("calling non-function and non-built-in")
+
+	}
+}
+
+// executeSpreadCall - the arrays on top of the stack are replaced
+// by their elements, which are passed as the arguments
+func (vm *VM) executeSpreadCall(numArrays int) error {
+	var args []object.Object
 
+	for _, arr := range vm.stack[vm.sp-numArrays : vm.sp] {
+		elements, err := object.SpreadArguments(arr)
+		if err != nil {
+			return newError("%s", err)
+		}
+		args = append(args, elements...)
 	}
+
+	vm.sp -= numArrays
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vm.executeCall(len(args))
+}
+
+// executeNamedCall - the arrays of positional arguments are followed
+// by a name and a value for each named argument. The arguments are
+// put in the order of the parameters, a left out one is null until
+// OpDefault computes its default
+func (vm *VM) executeNamedCall(numArrays, numNamed int) error {
+	pairsStart := vm.sp - 2*numNamed
+	arraysStart := pairsStart - numArrays
+
+	cl, ok := vm.stack[arraysStart-1].(*object.Closure)
+	if !ok {
+		if callee, ok := vm.stack[arraysStart-1].(*object.Builtin); ok {
+			return newError("%s does not take named arguments", callee.Type())
+		}
+
+		return newError("calling non-function and non-built-in")
+	}
+
+	var positional []object.Object
+	for _, arr := range vm.stack[arraysStart:pairsStart] {
+		elements, err := object.SpreadArguments(arr)
+		if err != nil {
+			return newError("%s", err)
+		}
+		positional = append(positional, elements...)
+	}
+
+	names := make([]string, numNamed)
+	values := make([]object.Object, numNamed)
+	for i := range numNamed {
+		name, ok := vm.stack[pairsStart+2*i].(*object.String)
+		if !ok {
+			return newError("argument name must be STRING, got %s", vm.stack[pairsStart+2*i].Type())
+		}
+		names[i], values[i] = name.Value, vm.stack[pairsStart+2*i+1]
+	}
+
+	fn := cl.Fn
+	args, err := object.BindNamedArguments(fn.ParameterNames, fn.NumDefaults, fn.Variadic, positional, names, values)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	passed := make([]bool, fn.NumParameters)
+	for i := range passed {
+		passed[i] = args[i] != nil
+		if !passed[i] {
+			args[i] = Null
+		}
+	}
+
+	vm.sp = arraysStart
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return vm.callClosure(cl, len(args), passed)
 }
 
 // 			Compute Base Pointer offset BEFORE		vm.stack[vm.sp - 1]
@@ -523,18 +933,60 @@ func (vm *VM) executeCall(numArgs int) error {
 //  			 ----------------------------
 //
 
-func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, passed []bool) error {
+	fn := cl.Fn
+
+	err := object.CheckArity(numArgs, fn.NumParameters, fn.NumDefaults, fn.Variadic)
+	if err != nil {
+		return newError("%s", err)
 	}
 
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	if frame.basePointer+fn.NumLocals > len(vm.stack) {
+		return newError("stack overflow")
+	}
+
+	// the arguments after the parameters are taken off the
+	// stack, they go in the rest array
+	rest := []object.Object{}
+	if extra := numArgs - fn.NumParameters; extra > 0 {
+		rest = make([]object.Object, extra)
+		copy(rest, vm.stack[vm.sp-extra:vm.sp])
+		vm.sp -= extra
+		numArgs -= extra
+	}
+
+	frame.numArgs = numArgs
+	frame.passed = passed
+
+	// a parameter without an argument is null until
+	// OpDefault computes its default
+	for ; numArgs < fn.NumParameters; numArgs++ {
+		vm.stack[vm.sp] = Null
+		vm.sp++
+	}
+
+	if fn.Variadic {
+		err = vm.pushAllocated(&object.Array{Elements: rest})
+		if err != nil {
+			return err
+		}
+		numArgs++
+	}
+
+	err = vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
 
 	// allocate space on the stack - create a "hole"
 	// reserve fn.NumLocals slots on the stack for local bindings
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 
+	// clear what earlier frames left in the slots, a stale cell
+	// would make a fresh local write through to an old closure
+	clear(vm.stack[frame.basePointer+numArgs : vm.sp])
+
 	return nil
 }
 
@@ -544,13 +996,21 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	result := builtin.Fn(args...)
 	vm.sp = vm.sp - numArgs - 1
 
-	if result != nil {
-		vm.push(result)
-	} else {
-		vm.push(Null)
-	}
+	switch result := result.(type) {
 
-	return nil
+	case nil:
+		return vm.push(Null)
+
+	// a failing builtin stops the run like any other runtime error
+	case *object.Error:
+		return newError("%s", result.Message)
+
+	case *object.Array, *object.Hash, *object.String:
+		return vm.pushAllocated(result)
+
+	default:
+		return vm.push(result)
+	}
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
@@ -559,19 +1019,28 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
 
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 
 	default:
-		return fmt.Errorf("index operatoer not supported: %s", left.Type())
+		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
+	// a BigInt index is always out of bounds
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return vm.push(Null)
+	}
+	i := integer.Value
+
 	// check for out of bounds
 	if i < 0 || i > max {
 		return vm.push(Null)
@@ -580,12 +1049,28 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	return vm.push(arrayObject.Elements[i])
 }
 
+// executeStringIndex - the code point at the index,
+// as a one character string
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		return vm.push(Null)
+	}
+
+	char, ok := str.(*object.String).CharAt(integer.Value)
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.pushAllocated(char)
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 
 	key, ok := index.(object.Hashable)
 	if !ok {
-		return fmt.Errorf("unusable as hash key: %s", index.Type())
+		return newError("unusable as hash key: %s", index.Type())
 	}
 
 	pair, ok := hashObject.Pairs[key.HashKey()]
@@ -606,6 +1091,17 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 	return &object.Array{Elements: elements}
 }
 
+// buildString - concatenate the display forms of the stack values
+func (vm *VM) buildString(startIndex, endIndex int) object.Object {
+	var out strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		out.WriteString(vm.stack[i].Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 	hashedPairs := make(map[object.HashKey]object.HashPair)
 
@@ -617,7 +1113,7 @@ func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			return nil, newError("unusable as hash key: %s", key.Type())
 		}
 
 		hashedPairs[hashKey.HashKey()] = pair
@@ -640,9 +1136,20 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// pushAllocated - push an object created by the program,
+// counting it against the MaxHeapObjects limit
+func (vm *VM) pushAllocated(o object.Object) error {
+	vm.heapObjects++
+	if vm.config.MaxHeapObjects > 0 && vm.heapObjects > vm.config.MaxHeapObjects {
+		return newError("maximum heap objects exceeded")
+	}
+
+	return vm.push(o)
+}
+
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		return newError("stack overflow")
 	}
 
 	vm.stack[vm.sp] = o
@@ -671,23 +1178,99 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 
 	switch {
 
-	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+	case object.IsInteger(left) && object.IsInteger(right):
 		return vm.executeBinaryIntegerOperation(op, left, right)
 
+	case object.IsNumeric(left) && object.IsNumeric(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType != rightType:
+		return newError("type mismatch: %s %s %s", leftType, operatorSymbols[op], rightType)
 	default:
-		return fmt.Errorf("unsupported types for binray operation: %s %s", leftType, rightType)
+		return unknownOperator(op, left, right)
 	}
 }
 
-func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+// operatorSymbols - the source form of the operator opcodes
+var operatorSymbols = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpMod:                "%",
+	code.OpBitAnd:             "&",
+	code.OpBitOr:              "|",
+	code.OpBitXor:             "^",
+	code.OpShiftLeft:          "<<",
+	code.OpShiftRight:         ">>",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+	code.OpGreaterThan:        ">",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThan:           "<",
+	code.OpLessThanOrEqual:    "<=",
+}
 
-	var result int64
+// unknownOperator - the operand types do not support the operator,
+// worded like the evaluator words it
+func unknownOperator(op code.Opcode, left, right object.Object) error {
+	return newError("unknown operator: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	var result object.Object
 
 	// EXECUTE
+	switch op {
+	case code.OpAdd:
+		result = object.AddIntegers(left, right)
+	case code.OpSub:
+		result = object.SubIntegers(left, right)
+	case code.OpMul:
+		result = object.MulIntegers(left, right)
+	case code.OpDiv:
+		if object.IsZeroInteger(right) {
+			return newError("division by zero")
+		}
+		result = object.DivIntegers(left, right)
+	case code.OpMod:
+		if object.IsZeroInteger(right) {
+			return newError("modulo by zero")
+		}
+		result = object.ModIntegers(left, right)
+	case code.OpBitAnd:
+		result = object.AndIntegers(left, right)
+	case code.OpBitOr:
+		result = object.OrIntegers(left, right)
+	case code.OpBitXor:
+		result = object.XorIntegers(left, right)
+	case code.OpShiftLeft, code.OpShiftRight:
+		count, err := object.ShiftCount(right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if op == code.OpShiftLeft {
+			result = object.ShiftLeftInteger(left, count)
+		} else {
+			result = object.ShiftRightInteger(left, count)
+		}
+	default:
+		return unknownOperator(op, left, right)
+	}
+
+	return vm.push(result)
+}
+
+// executeBinaryFloatOperation - at least one operand is a float,
+// the other one is converted to a float
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := object.ToFloat(left)
+	rightValue := object.ToFloat(right)
+
+	var result float64
+
 	switch op {
 	case code.OpAdd:
 		result = leftValue + rightValue
@@ -697,45 +1280,74 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 		result = leftValue * rightValue
 	case code.OpDiv:
 		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue)
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		return unknownOperator(op, left, right)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.push(&object.Float{Value: result})
 }
 
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
 	if op != code.OpAdd {
-		return fmt.Errorf("unknown string operator: %d", op)
+		return unknownOperator(op, left, right)
 	}
 
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	return vm.pushAllocated(&object.String{Value: leftValue + rightValue})
 }
 
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+	if object.IsInteger(left) && object.IsInteger(right) {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
-	switch op {
-	case code.OpEqual:
+	if object.IsNumeric(left) && object.IsNumeric(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
+
+	switch {
+	case op == code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(right == left))
-	case code.OpNotEqual:
+	case op == code.OpNotEqual:
 		return vm.push(nativeBoolToBooleanObject(right != left))
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
 	default:
-		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+		return unknownOperator(op, left, right)
 	}
 }
 
 func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	cmp := object.CompareIntegers(left, right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(cmp > 0))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp >= 0))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(cmp < 0))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp <= 0))
+	default:
+		return unknownOperator(op, left, right)
+	}
+}
+
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := object.ToFloat(left)
+	rightValue := object.ToFloat(right)
 
 	switch op {
 	case code.OpEqual:
@@ -744,8 +1356,14 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
 	default:
-		return fmt.Errorf("unknown operator: %d", op)
+		return unknownOperator(op, left, right)
 	}
 }
 
@@ -775,21 +1393,39 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInt:
+		return vm.push(object.NegateInteger(operand))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return newError("unknown operator: -%s", operand.Type())
 	}
+}
 
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+func (vm *VM) executeBitNotOperator() error {
+	operand := vm.pop()
+
+	if !object.IsInteger(operand) {
+		return newError("unknown operator: ~%s", operand.Type())
+	}
+
+	return vm.push(object.NotInteger(operand))
 }
 
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= len(vm.frames) {
+		return newError("maximum call depth exceeded")
+	}
+
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -1,14 +1,22 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ioanzicu/monkeyd/ast"
+	"github.com/ioanzicu/monkeyd/code"
 	"github.com/ioanzicu/monkeyd/compiler"
+	"github.com/ioanzicu/monkeyd/diagnostic"
 	"github.com/ioanzicu/monkeyd/lexer"
 	"github.com/ioanzicu/monkeyd/object"
 	"github.com/ioanzicu/monkeyd/parser"
+	"github.com/ioanzicu/monkeyd/token"
 )
 
 type vmTestCase struct {
@@ -46,6 +54,15 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+
+		// an expected error is the runtime error that stops the run
+		if expected, ok := tt.expected.(*object.Error); ok {
+			if _, ok := err.(*RuntimeError); !ok || err.Error() != expected.Message {
+				t.Errorf("wrong runtime error for %q. want=%q, got=%v", tt.input, expected.Message, err)
+			}
+			continue
+		}
+
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -67,6 +84,12 @@ func testExpectedObject(t *testing.T, i int, expected interface{}, actual object
 			t.Errorf("%d. testIntegerObject failed: %s", i, err)
 		}
 
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("%d. testFloatObject failed: %s", i, err)
+		}
+
 	case string:
 		err := testStringObject(expected, actual)
 		if err != nil {
@@ -159,6 +182,19 @@ func testIntegerObject(expected int64, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
@@ -195,6 +231,83 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"0.5 + 0.25", 0.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"10.0 - 2 * 3", 4.0},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"{1: 10}[1.0]", 10},
+		{"int(3.99)", 3},
+		{"float(3)", 3.0},
+		{`float("2.5")`, 2.5},
+		{"str(1.0)", "1.0"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"99999999999999999999 - 99999999999999999998", 1},
+		{"{99999999999999999999: 1}[99999999999999999998 + 1]", 1},
+		{"{1e20: 1}[100000000000000000000]", 1},
+		{"[1, 2][99999999999999999999]", Null},
+		{"str(99999999999999999999 * 10)", "999999999999999999990"},
+		{"float(99999999999999999999)", 1e20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("日本語")`, 3},
+		{`len(bytes("日本語"))`, 9},
+		{`"日本語"[1]`, "本"},
+		{`"abc"[3]`, Null},
+		{`"abc"[-1]`, Null},
+		{`slice("Zoë Ødegaard", 4)`, "Ødegaard"},
+		{`slice("Zoë Ødegaard", 0, 3)`, "Zoë"},
+		{`slice([1, 2, 3, 4], 1, 3)`, []int{2, 3}},
+		{`slice([1, 2], 5)`, []int{}},
+		{`bytes("é")`, []int{0xC3, 0xA9}},
+		{`let ñame = "José"; ñame[3]`, "é"},
+		{
+			`slice(1, 0)`,
+			&object.Error{Message: "argument to `slice` must be STRING or ARRAY, got INTEGER"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"if (false) { 1 } || 0", true},
+		{"let f = fn() { 1 / 0 }; false && f()", false},
+		{"let f = fn() { 1 / 0 }; true || f()", true},
+		{"let x = 5; x >= 1 && x <= 10", true},
+		{"let x = 5; x < 1 || x > 10", false},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBooleanExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"true", true},
@@ -274,6 +387,11 @@ func TestStringExpressions(t *testing.T) {
 		{`"monkey D."`, "monkey D."},
 		{`"mon" + "key D."`, "monkey D."},
 		{`"mon" + "key" + " D."`, "monkey D."},
+		{`let name = "D."; "monkey ${name}"`, "monkey D."},
+		{`"${1 + 2} ${true} ${[1, "a"]} ${{"k": 2}["k"]}"`, "3 true [1, a] 2"},
+		{`"nested ${"in${1}ner"}!"`, "nested in1ner!"},
+		{`let f = fn(x) { "<${x}>" }; "${f(1)}${f(2)}"`, "<1><2>"},
+		{`"\${literal}"`, "${literal}"},
 	}
 
 	runVmTests(t, tests)
@@ -566,6 +684,26 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 			input:    `fn(x, y) { x + y; }(1);`,
 			expected: `wrong number of arguments: want=2, got=1`,
 		},
+		{
+			input:    `fn(x, y = 1) { x + y; }();`,
+			expected: `wrong number of arguments: want=1 to 2, got=0`,
+		},
+		{
+			input:    `fn(x, y = 1) { x + y; }(1, 2, 3);`,
+			expected: `wrong number of arguments: want=1 to 2, got=3`,
+		},
+		{
+			input:    `fn(x, ...y) { x; }();`,
+			expected: `wrong number of arguments: want=at least 1, got=0`,
+		},
+		{
+			input:    `fn(x) { x; }(...[1, 2]);`,
+			expected: `wrong number of arguments: want=1, got=2`,
+		},
+		{
+			input:    `fn(x) { x; }(...1);`,
+			expected: `spread argument must be ARRAY, got INTEGER`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -589,6 +727,39 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a = 1, b = a * 2) { a * 10 + b }; f()", 12},
+		{"let f = fn(a = 1, b = a * 2) { a * 10 + b }; f(3)", 36},
+		{"let f = fn(a = b, b = 1) { a }; f()", Null},
+		{"let f = fn(head, ...tail) { tail }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(head, ...tail) { tail }; f(1)", []int{}},
+		{"let f = fn(a, b = 5, ...c) { a + b + len(c) }; f(1)", 6},
+		{"let f = fn(a, b = 5, ...c) { a + b + len(c) }; f(1, 2, 3, 4)", 5},
+		{"let f = fn(xs = []) { xs[len(xs)] = 1; len(xs) }; f(); f()", 1},
+		{"let f = fn(n, acc = 1) { if (n < 2) { acc } else { f(n - 1, acc * n) } }; f(5)", 120},
+		{"let f = fn(x = 1, g = fn() { x }) { x = 7; g() }; f()", 7},
+		{"let outer = fn(y) { fn(x = y) { x } }; outer(4)()", 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSpreadArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let add = fn(a, b, c) { a * 100 + b * 10 + c }; add(...[1, 2, 3])", 123},
+		{"let add = fn(a, b, c) { a * 100 + b * 10 + c }; add(1, ...[2], 3)", 123},
+		{"let add = fn(a, b, c) { a * 100 + b * 10 + c }; let xs = [2, 3]; add(...[], 1, ...xs)", 123},
+		{"let all = fn(...xs) { xs }; all(...[1, 2], ...[3])", []int{1, 2, 3}},
+		{"len(...[[1, 2]])", 2},
+		{"let f = fn(a, b = 10) { a + b }; f(...[1])", 11},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`len("")`, 0},
@@ -721,6 +892,308 @@ func TestClosures(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2", 3},
+		{"let x = 10; x -= 2; x *= 3; x /= 4; x", 6},
+		{"let x = 1; let y = 2; x = y = 5; x + y", 10},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let f = fn(x) { x += 1; x * 2 }; f(1)", 4},
+		{"let x = 1; let f = fn() { x = x + 10 }; f(); f(); x", 21},
+		{
+			input: `
+			let counter = fn() {
+				let n = 0;
+				fn() { n += 1 }
+			};
+			let c = counter();
+			c(); c();
+			c()
+			`,
+			expected: 3,
+		},
+		{
+			// the closures and the frame share one cell
+			input: `
+			let pair = fn() {
+				let n = 0;
+				let inc = fn() { n += 1 };
+				let get = fn() { n };
+				inc(); inc();
+				n = n * 10;
+				[inc(), get(), n]
+			};
+			pair()
+			`,
+			expected: []int{21, 21, 21},
+		},
+		{
+			// a closure nested two levels deep assigns the outer local
+			input: `
+			let outer = fn() {
+				let n = 1;
+				let middle = fn() { fn() { n *= 5 } };
+				middle()();
+				n
+			};
+			outer()
+			`,
+			expected: 5,
+		},
+		{
+			// a later frame reusing the slot does not write into the cell
+			input: `
+			let make = fn() { let n = 0; fn() { n } };
+			let c = make();
+			let other = fn() { let m = 99; m };
+			other();
+			c()
+			`,
+			expected: 0,
+		},
+		{
+			// independent counters do not share state
+			input: `
+			let counter = fn() { let n = 0; fn() { n += 1 } };
+			let a = counter();
+			let b = counter();
+			a(); a();
+			b()
+			`,
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 5) { i += 1; } i", 5},
+		{"let n = 0; while (true) { n += 1; if (n == 3) { break; } } n", 3},
+		{"let s = 0; for (let i = 0; i < 5; i += 1) { if (i % 2 == 0) { continue; } s += i; } s", 4},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x; } s", 6},
+		{`let s = ""; for (c in "añb") { s = c + s; } s`, "bña"},
+		{"let n = 0; for (;;) { n += 1; if (n > 9) { break; } } n", 10},
+		{
+			// break and continue leave the innermost loop only
+			input: `
+			let pairs = [];
+			for (a in [1, 2, 3]) {
+				for (b in [1, 2, 3]) {
+					if (b == a) { continue; }
+					if (b > 2) { break; }
+					pairs = push(pairs, a * 10 + b);
+				}
+			}
+			pairs
+			`,
+			expected: []int{12, 21, 31, 32},
+		},
+		{
+			// a loop in a function, left by a return
+			input: `
+			let find = fn(arr, target) {
+				let i = 0;
+				for (x in arr) {
+					if (x == target) { return i; }
+					i += 1;
+				}
+				-1
+			};
+			[find([5, 6, 7], 7), find([5], 1)]
+			`,
+			expected: []int{2, -1},
+		},
+		{
+			// every iteration captures its own variable
+			input: `
+			let fns = [];
+			for (x in [1, 2, 3]) {
+				let y = x * 10;
+				fns = push(fns, fn() { x + y });
+			}
+			[fns[0](), fns[1](), fns[2]()]
+			`,
+			expected: []int{11, 22, 33},
+		},
+		{
+			// the variables of a for loop are shared by its iterations
+			input: `
+			let fns = [];
+			for (let i = 0; i < 3; i += 1) {
+				fns = push(fns, fn() { i });
+			}
+			[fns[0](), fns[2]()]
+			`,
+			expected: []int{3, 3},
+		},
+		{
+			// a closure assigns a variable of the loop body
+			input: `
+			let total = fn() {
+				let sum = 0;
+				for (x in [1, 2, 3]) {
+					let add = fn() { sum += x };
+					add();
+				}
+				sum
+			};
+			total()
+			`,
+			expected: 6,
+		},
+		{"let f = fn() { while (false) { } }; f()", Null},
+		{"if (true) { let a = 1; }", Null},
+		{"let a = [1, 2]; for (x in a) { a[len(a)] = x; } a", []int{1, 2, 1, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"const a = 5; a * 2", 10},
+		{"const a = -5; const b = a; b", -5},
+		{"const a = 2.5; a * 2", 5.0},
+		{"const a = [1, 2]; a[0] = 9; a[0]", 9},
+		{"const a = 1; if (true) { const a = 2; a }", 2},
+		{"const a = 1; let f = fn() { let a = 2; a += 1; a }; f() + a", 4},
+		{"let x = 1; const c = x; x = 5; c", 1},
+		{"let f = fn(x) { const k = x * 2; fn() { k + x } }; f(3)()", 9},
+		{"for (x in [1, 2]) { const c = x * 10; }; const d = 3; d", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructureStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [a, b, c] = [1, 2]; c", Null},
+		{"let [a, ...rest] = [1, 2, 3]; rest", []int{2, 3}},
+		{"let [a, ...rest] = [1]; rest", []int{}},
+		{"let {name, age: years} = {\"name\": 1, \"age\": 23}; name + years", 24},
+		{"let {missing} = {}; missing", Null},
+		{"let {pos: [x, y]} = {\"pos\": [3, 4]}; x * y", 12},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; a * 10 + b", 21},
+		{"let f = fn(pair) { let [k, v] = pair; fn() { k - v } }; f([10, 4])()", 6},
+		{"let s = 0; for (let [i, n] = [0, 3]; i < n; i += 1) { s += i; }; s", 3},
+		{"if (true) { let [x] = [5]; x }", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (true) { let x = x + 1; x }", 2},
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let x = 1; let x = x + 1; x", 2},
+		{"let f = fn(x) { if (true) { let x = 10; }; x }; f(1)", 1},
+		{"let a = 1; if (true) { let a = 5; let g = fn() { a }; g() }", 5},
+		{"let f = fn() { let a = 1; if (a) { let a = a * 3; a = a + 1; a } else { 0 } }; f()", 4},
+		{
+			// a later let reusing the slot does not write into the
+			// cell a closure from the finished block shares
+			input: `
+			let f = fn() {
+				let g = if (true) { let a = 1; fn() { a } };
+				let b = 2;
+				g() * 10 + b
+			};
+			f()
+			`,
+			expected: 12,
+		},
+		{
+			input: `
+			let f = fn() {
+				let fns = [];
+				for (x in [1, 2]) { fns = push(fns, fn() { x }); }
+				let y = 7;
+				let z = 8;
+				fns[0]() + fns[1]() * 10
+			};
+			f()
+			`,
+			expected: 21,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[1] = 20; a", []int{1, 20, 3}},
+		{"let a = [1, 2, 3]; a[2] += 5", 8},
+		{"let a = []; a[0] = 1; a[1] = 2; a[len(a)] = 3; a", []int{1, 2, 3}},
+		{"let a = [0]; let b = a; b[0] = 7; a[0]", 7},
+		{`let h = {}; h["one"] = 1; h["two"] = 2; h["one"] + h["two"]`, 3},
+		{`let h = {"n": 1}; h["n"] -= 5; h["n"]`, -4},
+		{"let m = [[0, 0], [0, 0]]; m[1][0] = 5; m[1]", []int{5, 0}},
+		{
+			// index and collection are evaluated once
+			input: `
+			let calls = 0;
+			let a = [10, 20];
+			let at = fn(i) { calls += 1; i };
+			a[at(1)] *= 2;
+			[a[1], calls]
+			`,
+			expected: []int{40, 1},
+		},
+		{
+			input: `
+			let fill = fn(n) {
+				let a = [];
+				let loop = fn(i) { if (i < n) { a[i] = i * i; loop(i + 1) } };
+				loop(0);
+				a
+			};
+			fill(4)
+			`,
+			expected: []int{0, 1, 4, 9},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2][3] = 0", "index out of range: 3 with length 2"},
+		{"[1, 2][-1] = 0", "index out of range: -1 with length 2"},
+		{"[1][99999999999999999999] = 0", "index out of range: 99999999999999999999 with length 1"},
+		{`[1]["0"] = 0`, "array index must be INTEGER, got STRING"},
+		{"{}[fn() {}] = 1", "unusable as hash key: CLOSURE"},
+		{`"abc"[0] = "x"`, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("input %q - expected VM error but resulted in none.", tt.input)
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("input %q - wrong VM error: want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
 func TestRecursiveFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -796,3 +1269,328 @@ func TestRecursiveFibonacci(t *testing.T) {
 
 	runVmTests(t, tests)
 }
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+let apply = fn(f) {
+  f(1, "two")
+};
+let run = fn() { apply(add) };
+run();`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+
+	rtErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected *RuntimeError. got=%T (%v)", err, err)
+	}
+
+	if rtErr.Message != "type mismatch: INTEGER + STRING" {
+		t.Errorf("wrong message. got=%q", rtErr.Message)
+	}
+
+	expected := []StackFrame{
+		{Function: "add", Offset: 4, Line: 2},
+		{Function: "apply", Offset: 8, Line: 5},
+		{Function: "run", Offset: 6, Line: 7},
+		{Function: "<main>", Offset: 24, Line: 8},
+	}
+
+	if len(rtErr.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d, got=%d\n%s", len(expected), len(rtErr.Trace), rtErr.StackTrace())
+	}
+
+	for i, sf := range expected {
+		if rtErr.Trace[i] != sf {
+			t.Errorf("wrong frame %d. want=%+v, got=%+v", i, sf, rtErr.Trace[i])
+		}
+	}
+
+	expectedTrace := "\tat add (line 2, offset 0004)\n" +
+		"\tat apply (line 5, offset 0008)\n" +
+		"\tat run (line 7, offset 0006)\n" +
+		"\tat <main> (line 8, offset 0024)\n"
+
+	if rtErr.StackTrace() != expectedTrace {
+		t.Errorf("wrong stack trace.\nwant=%q\ngot=%q", expectedTrace, rtErr.StackTrace())
+	}
+}
+
+func TestFprintError(t *testing.T) {
+	input := "let zero = 0;\nlet f = fn() { 1 / zero };\nf();"
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{
+			err,
+			"error[R001]: division by zero\n" +
+				" --> main.mk:2\n" +
+				"  |\n" +
+				"2 | let f = fn() { 1 / zero };\n" +
+				"stack trace:\n" +
+				"\tat f (line 2, offset 0006)\n" +
+				"\tat <main> (line 3, offset 0016)\n",
+		},
+		{
+			diagnostic.Errorf(diagnostic.UndefinedVariable, diagnostic.Span{
+				Start: token.Position{Filename: "main.mk", Line: 1, Column: 5},
+				End:   token.Position{Filename: "main.mk", Line: 1, Column: 9},
+			}, "undefined variable zero"),
+			"error[C001]: undefined variable zero\n" +
+				" --> main.mk:1:5\n" +
+				"  |\n" +
+				"1 | let zero = 0;\n" +
+				"  |     ^^^^\n",
+		},
+		{
+			fmt.Errorf("too many constants"),
+			"error: too many constants\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		FprintError(&out, "main.mk", input, tt.err)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong rendering.\nwant=%q\ngot =%q", tt.expected, out.String())
+		}
+	}
+}
+
+func TestConfigLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		config   Config
+		expected string
+	}{
+		{
+			input:    `let f = fn(x) { f(x + 1) }; f(0);`,
+			config:   DefaultConfig(),
+			expected: "stack overflow",
+		},
+		{
+			input:    `let f = fn(x) { f(x + 1) }; f(0);`,
+			config:   Config{StackSize: 4 * StackSize},
+			expected: "maximum call depth exceeded",
+		},
+		{
+			input:    `let f = fn(x) { if (x == 0) { 0 } else { f(x - 1) } }; f(10);`,
+			config:   Config{MaxFrames: 5},
+			expected: "maximum call depth exceeded",
+		},
+		{
+			input:    `let f = fn(x) { let a = 1; let b = 2; x + a + b }; f(1);`,
+			config:   Config{StackSize: 3},
+			expected: "stack overflow",
+		},
+		{
+			input:    `[1, 2, 3, 4, 5];`,
+			config:   Config{StackSize: 4},
+			expected: "stack overflow",
+		},
+		{
+			input:    `let a = 1; let b = 2; let c = 3;`,
+			config:   Config{GlobalsSize: 2},
+			expected: "maximum number of globals exceeded",
+		},
+		{
+			input:    `let a = [1]; let b = push(a, 2); let c = {"k": b};`,
+			config:   Config{MaxHeapObjects: 2},
+			expected: "maximum heap objects exceeded",
+		},
+		{
+			input:    `let f = fn(x) { if (x == 0) { 0 } else { f(x - 1) } }; f(100);`,
+			config:   Config{InstructionBudget: 50},
+			expected: "instruction budget exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithConfig(comp.Bytecode(), tt.config)
+		err = vm.Run()
+
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Errorf("expected *RuntimeError for %q. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestConfigWithinLimits(t *testing.T) {
+	input := `let f = fn(x) { if (x == 0) { [x] } else { f(x - 1) } }; f(3);`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	config := Config{MaxFrames: 5, StackSize: 16, GlobalsSize: 1, MaxHeapObjects: 2, InstructionBudget: 100}
+	vm := NewWithConfig(comp.Bytecode(), config)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 0, []int{0}, vm.LastPoppedStackElem())
+}
+
+func TestMainProgramReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{`return 5; 6`, 5},
+		{`let f = fn() { 1 }; if (f() == 1) { return f() + 1; }; 9`, 2},
+		{`for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } }`, 20},
+	}
+
+	for i, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := NewWithConfig(comp.Bytecode(), DefaultConfig())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, i, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestUnsetSlotsAreNull(t *testing.T) {
+	// what a bytecode file can read before anything is stored
+	tests := []code.Instructions{
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpGetLocal, 0),
+	}
+
+	for _, ins := range tests {
+		bc := &compiler.Bytecode{
+			Instructions: append(ins, code.Make(code.OpPop)...),
+			NumLocals:    1,
+		}
+
+		vm := New(bc)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if vm.LastPoppedStackElem() != Null {
+			t.Errorf("unset slot read with %q is not Null. got=%v", ins, vm.LastPoppedStackElem())
+		}
+	}
+}
+
+func TestStackTraceElidesDeepRecursion(t *testing.T) {
+	rtErr := &RuntimeError{Message: "maximum call depth exceeded"}
+	for i := 0; i < 25; i++ {
+		rtErr.Trace = append(rtErr.Trace, StackFrame{Function: "f", Offset: 2, Line: 1})
+	}
+
+	lines := strings.Split(strings.TrimSuffix(rtErr.StackTrace(), "\n"), "\n")
+	if len(lines) != 21 {
+		t.Fatalf("wrong number of trace lines. want=21, got=%d", len(lines))
+	}
+
+	if lines[10] != "\t... 5 frames omitted" {
+		t.Errorf("wrong elision line. got=%q", lines[10])
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	slowFibonacci := `
+	let fibonacci = fn(x) {
+		if (x == 0) { return 0; }
+		if (x == 1) { return 1; }
+		fibonacci(x - 1) + fibonacci(x - 2);
+	};
+	fibonacci(35);
+	`
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelDeadline()
+
+	later, cancelLater := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancelLater)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected error
+	}{
+		{"canceled before run", canceled, ErrCanceled},
+		{"deadline", deadline, ErrDeadlineExceeded},
+		{"canceled while running", later, ErrCanceled},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(slowFibonacci))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.RunContext(tt.ctx)
+
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected error wrapping %q. got=%v", tt.name, tt.expected, err)
+		}
+
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Errorf("%s: expected *RuntimeError. got=%T", tt.name, err)
+		}
+	}
+}
+
+func TestRunContextCompletes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn(x) { if (x == 0) { 0 } else { f(x - 1) } }; f(500);`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.RunContext(ctx); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, 0, 0, vm.LastPoppedStackElem())
+}